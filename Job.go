@@ -1,18 +1,27 @@
 package main
 
 import (
+	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// maxNum and maxBytes are the default count of the rotated log files and the
+// default size of a log file.
 const maxNum = 5
 const maxBytes = 5 * 1024 * 1024
 
+const defaultRetryDelay = 1 * time.Minute
+const defaultRetryBackoff = 2.0
+
 type Job interface {
 	Run()
 }
@@ -26,33 +35,500 @@ type ShellJob struct {
 	logfile      string
 	timeout      time.Duration
 	expression   string
-	status       int32
+
+	max_retries   int
+	retry_delay   time.Duration
+	retry_backoff float64
+
+	concurrency       string
+	concurrency_limit int
+	priority          int
+
+	per_run_log         bool
+	log_retention_count int
+	log_retention_age   time.Duration
+	log_max_bytes       int64
+	log_max_num         int
+	log_compress        bool
+	log_daily           bool
+
+	output            string
+	stderr_tail_bytes int
+	log_timestamp     bool
+
+	notify_to []string
+	webhooks  []string
+
+	depends_on []string
+	on_success []string
+	on_failure []string
+
+	upstreams_succeeded map[string]bool // the jobs in depends_on that are succeeded in this cycle.
+
+	workflow *workflow
+
+	lock      sync.Mutex
+	instances map[*runInstance]bool
+	queued    int
+	waiting   int32
+	backend   *dbBackend
+	on_idle   func() // it is called after the last run is finished.
+
+	last_start_at        time.Time
+	last_end_at          time.Time
+	last_status          string
+	last_log_file        string
+	last_stderr_tail     string
+	last_result          *RunResult
+	consecutive_failures int
+	is_failing           bool
+	total_runs           int
+	failures             int
+	timeouts             int
+	skipped              int
+	last_success_at      time.Time
+	durations            histogram
 }
 
+const (
+	CONCURRENCY_FORBID  = "forbid"
+	CONCURRENCY_ALLOW   = "allow"
+	CONCURRENCY_REPLACE = "replace"
+	CONCURRENCY_QUEUE   = "queue"
+)
+
+// runInstance is a run of a job, includes all the attempts of it.
+type runInstance struct {
+	pid    int32
+	lock   sync.Mutex
+	status string // it is the status of the run after it is killed.
+	killed chan struct{}
+}
+
+func newRunInstance() *runInstance {
+	return &runInstance{killed: make(chan struct{})}
+}
+
+func (self *runInstance) setPid(pid int) {
+	atomic.StoreInt32(&self.pid, int32(pid))
+	if 0 != pid && self.isKilled() {
+		killByPid(pid)
+	}
+}
+
+func (self *runInstance) isKilled() bool {
+	return "" != self.killedStatus()
+}
+
+func (self *runInstance) killedStatus() string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.status
+}
+
+// kill kills the process of the run, status is the status of the run.
+func (self *runInstance) kill(status string) error {
+	self.lock.Lock()
+	if "" == self.status {
+		self.status = status
+		close(self.killed)
+	}
+	self.lock.Unlock()
+
+	if pid := atomic.LoadInt32(&self.pid); 0 != pid {
+		return killByPid(int(pid))
+	}
+	return nil
+}
+
+// a record of the sched_job_runs table, it is written after every run.
+type jobRun struct {
+	id          int64
+	job_id      int64
+	job_name    string
+	attempt     int
+	begin_at    time.Time
+	end_at      time.Time
+	status      string
+	log_excerpt string
+	log_file    string
+	stderr_tail string
+	RunResult
+}
+
+const (
+	RUN_OK          = "ok"
+	RUN_FAILED      = "failed"
+	RUN_TIMEOUT     = "timeout"
+	RUN_SKIPPED     = "skipped"
+	RUN_KILLED      = "killed"
+	RUN_INTERRUPTED = "interrupted"
+)
+
+const maxExcerptBytes = 4 * 1024
+
 type JobFromDB struct {
 	ShellJob
 	updated_at time.Time
 	created_at time.Time
+	lease      lease
+
+	// log_options is the log and output options of the job, such as
+	// per_run_log, log_max_bytes and output, the global options are used if
+	// they are missing.
+	log_options map[string]interface{}
 }
 
+// logOptions is the keys of log_options.
+var logOptions = []string{"per_run_log",
+	"log_retention_count",
+	"log_retention_age",
+	"log_max_bytes",
+	"log_max_num",
+	"log_compress",
+	"log_rotate",
+	"output",
+	"stderr_tail_bytes",
+	"log_timestamp"}
+
+func (self *JobFromDB) Stats() map[string]interface{} {
+	stats := self.ShellJob.Stats()
+	stats["id"] = self.id
+	stats["updated_at"] = self.updated_at
+	return stats
+}
+
+// Run starts a run of the job, a overlapping run is handled by the
+// concurrency policy of the job:
+//
+//	forbid  - skip the new run, it is the default.
+//	allow   - run in parallel, at most concurrency_limit runs if it is greate 0.
+//	replace - kill the running runs and start the new run.
+//	queue   - start the new run after the running run is finished, at most
+//	          concurrency_limit runs are queued if it is greate 0.
 func (self *ShellJob) Run() {
-	if !atomic.CompareAndSwapInt32(&self.status, 0, 1) {
-		log.Println("[" + self.name + "] running!")
-		return
+	self.lock.Lock()
+	if 0 != len(self.instances) {
+		switch self.concurrency {
+		case CONCURRENCY_ALLOW:
+			if 0 < self.concurrency_limit && len(self.instances) >= self.concurrency_limit {
+				self.lock.Unlock()
+				self.skip("the count of running is reach the limit(" + fmt.Sprint(self.concurrency_limit) + ")")
+				return
+			}
+		case CONCURRENCY_REPLACE:
+			log.Println("[" + self.name + "] running, kill it and start the new run.")
+			for instance, _ := range self.instances {
+				go func(instance *runInstance) {
+					if e := instance.kill(RUN_KILLED); nil != e {
+						log.Println("["+self.name+"] kill the running failed,", e)
+					}
+				}(instance)
+			}
+		case CONCURRENCY_QUEUE:
+			if 0 < self.concurrency_limit && self.queued >= self.concurrency_limit {
+				self.lock.Unlock()
+				self.skip("the count of queued is reach the limit(" + fmt.Sprint(self.concurrency_limit) + ")")
+				return
+			}
+			self.queued++
+			self.lock.Unlock()
+			log.Println("[" + self.name + "] running, queue the new run.")
+			return
+		default:
+			self.lock.Unlock()
+			self.skip("running")
+			return
+		}
 	}
+	instance := self.newInstance()
+	self.lock.Unlock()
+
+	go self.runInstances(instance)
+}
+
+// newInstance adds a run instance, the lock must be held.
+func (self *ShellJob) newInstance() *runInstance {
+	if nil == self.instances {
+		self.instances = map[*runInstance]bool{}
+	}
+	instance := newRunInstance()
+	self.instances[instance] = true
+	return instance
+}
+
+// runInstances runs instance, and then the queued runs.
+func (self *ShellJob) runInstances(instance *runInstance) {
+	for {
+		self.runWithRetries(instance)
+
+		self.lock.Lock()
+		delete(self.instances, instance)
+		if 0 == self.queued {
+			is_idle := 0 == len(self.instances)
+			self.lock.Unlock()
+			if is_idle && nil != self.on_idle {
+				self.on_idle()
+			}
+			return
+		}
+		self.queued--
+		instance = self.newInstance()
+		self.lock.Unlock()
+	}
+}
+
+func (self *ShellJob) skip(reason string) {
+	log.Println("[" + self.name + "] " + reason + ", skip it.")
+	self.lock.Lock()
+	self.skipped++
+	self.lock.Unlock()
+
+	now := time.Now()
+	run := &jobRun{job_id: self.id,
+		job_name:    self.name,
+		begin_at:    now,
+		end_at:      now,
+		status:      RUN_SKIPPED,
+		log_excerpt: reason + ", skip it.",
+		RunResult:   RunResult{ExitCode: -1}}
+	if nil != self.backend {
+		if e := self.backend.saveRun(run); nil != e {
+			log.Println("["+self.name+"] save run history failed,", e)
+		}
+	}
+	self.notify(EVENT_SKIPPED, run)
+}
+
+// runWithRetries runs the job, it is retried at most max_retries times while
+// it is failed, the delay between two attempts is multiplied by retry_backoff.
+func (self *ShellJob) runWithRetries(instance *runInstance) {
+	delay := self.retry_delay
+	for attempt := 0; ; attempt++ {
+		atomic.AddInt32(&self.waiting, 1)
+		workers.acquire(self.priority)
+		atomic.AddInt32(&self.waiting, -1)
+		if instance.isKilled() {
+			workers.release()
+			return
+		}
 
-	go func() {
-		defer atomic.StoreInt32(&self.status, 0)
 		e := self.rotate_file()
 		if nil != e {
 			log.Println("["+self.name+"] rotate log file failed,", e)
 		}
-		self.do_run()
-	}()
+		self.notify(EVENT_START, &jobRun{job_id: self.id,
+			job_name: self.name,
+			attempt:  attempt,
+			begin_at: time.Now(),
+			status:   "running"})
+		var run *jobRun
+		if nil != self.workflow {
+			run = self.workflow.run(self, instance, attempt)
+		} else {
+			run = self.do_run(instance, attempt)
+		}
+		workers.release()
+		self.record(run)
+		if nil != self.backend {
+			if e := self.backend.saveRun(run); nil != e {
+				log.Println("["+self.name+"] save run history failed,", e)
+			}
+		}
+
+		if RUN_OK == run.status || instance.isKilled() || attempt >= self.max_retries {
+			self.notifyResult(run)
+			self.triggerDownstream(run)
+			return
+		}
+
+		log.Println("["+self.name+"] run "+run.status+", retry after", delay, "("+fmt.Sprint(attempt+1)+"/"+fmt.Sprint(self.max_retries)+")")
+		select {
+		case <-time.After(delay):
+		case <-instance.killed:
+			return
+		}
+		if self.retry_backoff > 1 {
+			delay = time.Duration(float64(delay) * self.retry_backoff)
+		}
+	}
+}
+
+func (self *ShellJob) record(run *jobRun) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.last_start_at = run.begin_at
+	self.last_end_at = run.end_at
+	self.last_status = run.status
+	self.last_result = &run.RunResult
+	self.last_stderr_tail = run.stderr_tail
+	self.total_runs++
+	self.durations.observe(run.end_at.Sub(run.begin_at).Seconds())
+	switch run.status {
+	case RUN_OK:
+		self.consecutive_failures = 0
+		self.last_success_at = run.end_at
+	case RUN_TIMEOUT:
+		self.consecutive_failures++
+		self.failures++
+		self.timeouts++
+	case RUN_FAILED:
+		self.consecutive_failures++
+		self.failures++
+	}
+}
+
+// Stats returns the state of the job and the result of the last run of it.
+func (self *ShellJob) Stats() map[string]interface{} {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	pids := make([]int32, 0, len(self.instances))
+	for instance, _ := range self.instances {
+		if pid := atomic.LoadInt32(&instance.pid); 0 != pid {
+			pids = append(pids, pid)
+		}
+	}
+
+	stats := map[string]interface{}{"name": self.name,
+		"running":              0 != len(self.instances),
+		"pids":                 pids,
+		"total_runs":           self.total_runs,
+		"consecutive_failures": self.consecutive_failures}
+	if 0 != len(pids) {
+		stats["pid"] = pids[0]
+	}
+	if 0 != self.total_runs {
+		stats["last_start_at"] = self.last_start_at
+		stats["last_end_at"] = self.last_end_at
+		stats["last_status"] = self.last_status
+	}
+	if "" != self.last_log_file {
+		stats["last_log_file"] = self.last_log_file
+	}
+	if "" != self.last_stderr_tail {
+		stats["last_stderr_tail"] = self.last_stderr_tail
+	}
+	if nil != self.workflow && nil != self.workflow.last_results {
+		stats["last_steps"] = self.workflow.last_results
+	}
+	if nil != self.last_result {
+		stats["last_result"] = self.last_result.toMap()
+	}
+	return stats
+}
+
+func (self *ShellJob) isRunning() bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return 0 != len(self.instances)
+}
+
+// Kill kills the processes of the job if it is running, and clear the queued
+// runs.
+func (self *ShellJob) Kill() error {
+	if !self.isRunning() {
+		return errors.New("job '" + self.name + "' isn't running")
+	}
+	log.Println("[" + self.name + "] kill it by user.")
+	return self.killAll(RUN_KILLED)
+}
+
+// interrupt kills the processes of the job while the daemon is shutdown.
+func (self *ShellJob) interrupt() error {
+	if !self.isRunning() {
+		return nil
+	}
+	log.Println("[" + self.name + "] interrupt it.")
+	return self.killAll(RUN_INTERRUPTED)
+}
+
+// killAll kills all the runs and clear the queued runs.
+func (self *ShellJob) killAll(status string) error {
+	self.lock.Lock()
+	self.queued = 0
+	instances := make([]*runInstance, 0, len(self.instances))
+	for instance, _ := range self.instances {
+		instances = append(instances, instance)
+	}
+	self.lock.Unlock()
+
+	// the runs are killed at the same time, so that the grace periods of
+	// killing them are overlapped.
+	errs := make([]error, len(instances))
+	var wait sync.WaitGroup
+	for idx, instance := range instances {
+		wait.Add(1)
+		go func(idx int, instance *runInstance) {
+			defer wait.Done()
+			errs[idx] = instance.kill(status)
+		}(idx, instance)
+	}
+	wait.Wait()
+
+	var last error
+	for _, e := range errs {
+		if nil != e {
+			last = e
+		}
+	}
+	return last
+}
+
+func (self *ShellJob) maxLogNum() int {
+	if 0 < self.log_max_num {
+		return self.log_max_num
+	}
+	return maxNum
+}
+
+func (self *ShellJob) maxLogBytes() int64 {
+	if 0 < self.log_max_bytes {
+		return self.log_max_bytes
+	}
+	return maxBytes
+}
+
+// needRotate returns true if the log file is greate than the max bytes, or it
+// is not written today while it is rotated daily.
+func (self *ShellJob) needRotate(st os.FileInfo) bool {
+	if st.Size() >= self.maxLogBytes() {
+		return true
+	}
+	if self.log_daily && 0 != st.Size() {
+		y1, m1, d1 := st.ModTime().Date()
+		y2, m2, d2 := time.Now().Date()
+		return y1 != y2 || m1 != m2 || d1 != d2
+	}
+	return false
+}
+
+// rotatedFile returns the existing file of the generation, it is compressed
+// if the name ends with '.gz'.
+func rotatedFile(logfile string, num int) string {
+	name := logfile + fmt.Sprintf(".%04d", num)
+	if fileExists(name + ".gz") {
+		return name + ".gz"
+	}
+	if fileExists(name) {
+		return name
+	}
+	return ""
 }
 
 func (self *ShellJob) rotate_file() error {
-	st, err := os.Stat(self.logfile)
+	if self.per_run_log {
+		return self.removeRunLogs()
+	}
+	if OUTPUT_SEPARATE == self.output {
+		if e := self.rotateLog(errLogFile(self.logfile)); nil != e {
+			return e
+		}
+	}
+	return self.rotateLog(self.logfile)
+}
+
+func (self *ShellJob) rotateLog(logfile string) error {
+	st, err := os.Stat(logfile)
 	if nil != err { // file exists
 		if os.IsNotExist(err) {
 			return nil
@@ -60,54 +536,146 @@ func (self *ShellJob) rotate_file() error {
 		return err
 	}
 
-	if st.Size() < maxBytes {
+	if !self.needRotate(st) {
 		return nil
 	}
 
-	fname2 := self.logfile + fmt.Sprintf(".%04d", maxNum)
-	_, err = os.Stat(fname2)
-	if nil == err {
-		err = os.Remove(fname2)
+	max_num := self.maxLogNum()
+	if fname := rotatedFile(logfile, max_num); "" != fname {
+		err = os.Remove(fname)
 		if err != nil {
 			return err
 		}
 	}
 
-	fname1 := fname2
-	for num := maxNum - 1; num > 0; num-- {
-		fname2 = fname1
-		fname1 = self.logfile + fmt.Sprintf(".%04d", num)
-
-		_, err = os.Stat(fname1)
-		if nil != err {
+	for num := max_num - 1; num > 0; num-- {
+		fname1 := rotatedFile(logfile, num)
+		if "" == fname1 {
 			continue
 		}
+		fname2 := logfile + fmt.Sprintf(".%04d", num+1)
+		if strings.HasSuffix(fname1, ".gz") {
+			fname2 += ".gz"
+		}
 		err = os.Rename(fname1, fname2)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = os.Rename(self.logfile, fname1)
+	fname1 := logfile + fmt.Sprintf(".%04d", 1)
+	err = os.Rename(logfile, fname1)
 	if err != nil {
 		return err
 	}
+	if self.log_compress {
+		return compressFile(fname1)
+	}
 	return nil
 }
 
-func (self *ShellJob) do_run() {
-	out, e := os.OpenFile(self.logfile, os.O_APPEND|os.O_CREATE, 0)
+// compressFile compresses the file into the file that is appended '.gz' and
+// removes it.
+func compressFile(file string) error {
+	in, e := os.Open(file)
 	if nil != e {
-		log.Println("["+self.name+"] open log file("+self.logfile+") failed,", e)
-		return
+		return e
+	}
+	defer in.Close()
+
+	out, e := os.OpenFile(file+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if nil != e {
+		return e
+	}
+	w := gzip.NewWriter(out)
+	if _, e = io.Copy(w, in); nil == e {
+		e = w.Close()
+	}
+	if ce := out.Close(); nil == e {
+		e = ce
+	}
+	if nil != e {
+		os.Remove(file + ".gz")
+		return e
+	}
+	in.Close()
+	return os.Remove(file)
+}
+
+func (self *ShellJob) do_run(instance *runInstance, attempt int) *jobRun {
+	run := &jobRun{job_id: self.id,
+		job_name:  self.name,
+		attempt:   attempt,
+		begin_at:  time.Now(),
+		status:    RUN_FAILED,
+		RunResult: RunResult{ExitCode: -1}}
+	defer func() {
+		run.end_at = time.Now()
+	}()
+
+	logfile, e := self.openLogFile(run.begin_at)
+	if nil != e {
+		log.Println("["+self.name+"] open log file("+logfile+") failed,", e)
+		run.log_excerpt = "open log file(" + logfile + ") failed, " + e.Error()
+		return run
+	}
+	run.log_file = logfile
+	out, e := os.OpenFile(logfile, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
+	if nil != e {
+		log.Println("["+self.name+"] open log file("+logfile+") failed,", e)
+		run.log_excerpt = "open log file(" + logfile + ") failed, " + e.Error()
+		return run
 	}
 	defer out.Close()
-	io.WriteString(out, "=============== begin ===============\r\n")
-	defer io.WriteString(out, "===============  end  ===============\r\n")
+	offset, _ := out.Seek(0, os.SEEK_END)
+	defer func() {
+		run.log_excerpt = readExcerpt(logfile, offset, maxExcerptBytes)
+	}()
+	if 0 == attempt {
+		io.WriteString(out, "=============== begin at "+run.begin_at.Format(outputTimeLayout)+" ===============\r\n")
+	} else {
+		io.WriteString(out, "=============== begin(retry "+fmt.Sprint(attempt)+"/"+fmt.Sprint(self.max_retries)+") at "+run.begin_at.Format(outputTimeLayout)+" ===============\r\n")
+	}
+	defer func() {
+		now := time.Now()
+		io.WriteString(out, "===============  end at "+now.Format(outputTimeLayout)+", duration "+now.Sub(run.begin_at).String()+" ===============\r\n")
+	}()
 
 	cmd := exec.Command(self.execute, self.arguments...)
-	cmd.Stderr = out
-	cmd.Stdout = out
+	shared := &lockedWriter{w: out}
+	stdout, stderr, closeStreams, e := self.openStreams(logfile, out, shared)
+	if nil != e {
+		io.WriteString(out, "start failed, open the stderr file failed, "+e.Error()+"\r\n")
+		log.Println("["+self.name+"] open the stderr file failed,", e)
+		return run
+	}
+	defer closeStreams()
+
+	// the file is passed to the process as is, so that the process isn't
+	// waited for the children that inherit it, the tail of stderr is read
+	// back from the file after the process is exited, it is the tail of the
+	// whole output while the output is merged.
+	var stderr_tail func() string
+	stderr_file, is_file := stderr.(*os.File)
+	if 0 < self.stderr_tail_bytes && !is_file {
+		tail := &tailBuffer{max: self.stderr_tail_bytes}
+		stderr = io.MultiWriter(stderr, tail)
+		stderr_tail = tail.String
+	}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	// the pipes of the timestamped output are closed after the process is
+	// exited, even if they are inherited by the children.
+	cmd.WaitDelay = pipeWaitDelay
+	prepareProcess(cmd)
+	if "" != self.directory {
+		if !dirExists(self.directory) {
+			io.WriteString(out, "start failed, directory '"+self.directory+"' is not exists.\r\n")
+			log.Println("[" + self.name + "] start failed, directory '" + self.directory + "' is not exists.")
+			return run
+		}
+		cmd.Dir = self.directory
+	}
 
 	var environments []string
 	if nil != self.environments && 0 != len(self.environments) {
@@ -136,10 +704,24 @@ func (self *ShellJob) do_run() {
 	}
 	io.WriteString(out, "\r\n===============  out  ===============\r\n")
 
+	if 0 < self.stderr_tail_bytes && is_file {
+		tail_offset, _ := stderr_file.Seek(0, os.SEEK_END)
+		stderr_tail = func() string {
+			return readExcerpt(stderr_file.Name(), tail_offset, int64(self.stderr_tail_bytes))
+		}
+	}
+
 	if e = cmd.Start(); nil != e {
 		io.WriteString(out, "start failed, "+e.Error()+"\r\n")
-		return
+		return run
+	}
+	if e = attachProcess(cmd); nil != e {
+		log.Println("["+self.name+"] attach process failed, the children of it may not be killed,", e)
 	}
+	defer detachProcess(cmd.Process.Pid)
+	instance.setPid(cmd.Process.Pid)
+	defer instance.setPid(0)
+	started_at := time.Now()
 	c := make(chan error, 10)
 	go func() {
 		c <- cmd.Wait()
@@ -147,16 +729,59 @@ func (self *ShellJob) do_run() {
 
 	select {
 	case e := <-c:
+		if exec.ErrWaitDelay == e {
+			e = nil
+		}
 		out.Seek(0, os.SEEK_END)
-		if nil != e {
-			io.WriteString(out, "run failed, "+e.Error()+"\r\n")
+		run.RunResult = newRunResult(cmd.ProcessState, time.Now().Sub(started_at))
+		if nil != stderr_tail {
+			run.stderr_tail = stderr_tail()
+		}
+		if status := instance.killedStatus(); "" != status {
+			run.status = status
+			io.WriteString(shared, "run "+status+", "+fmt.Sprint(e)+"\r\n")
+		} else if nil != e {
+			io.WriteString(shared, "run failed, "+e.Error()+"\r\n")
 		} else if nil != cmd.ProcessState {
-			io.WriteString(out, "run ok, exit with "+cmd.ProcessState.String()+".\r\n")
+			run.status = RUN_OK
+			io.WriteString(shared, "run ok, exit with "+cmd.ProcessState.String()+".\r\n")
 		}
 	case <-time.After(self.timeout):
 		killByPid(cmd.Process.Pid)
+		select {
+		case <-c:
+			run.RunResult = newRunResult(cmd.ProcessState, time.Now().Sub(started_at))
+		case <-time.After(1 * time.Second):
+			run.Duration = time.Now().Sub(started_at)
+		}
+		run.status = RUN_TIMEOUT
+		run.IsTimeout = true
+		if nil != stderr_tail {
+			run.stderr_tail = stderr_tail()
+		}
 		out.Seek(0, os.SEEK_END)
-		io.WriteString(out, "run timeout, kill it.\r\n")
+		io.WriteString(shared, "run timeout, kill it.\r\n")
 		log.Println("[" + self.name + "] run timeout, kill it.")
 	}
+	return run
+}
+
+// readExcerpt returns the last max bytes that are written after offset.
+func readExcerpt(file string, offset int64, max int64) string {
+	f, e := os.Open(file)
+	if nil != e {
+		return ""
+	}
+	defer f.Close()
+
+	st, e := f.Stat()
+	if nil != e || st.Size() <= offset {
+		return ""
+	}
+	if st.Size()-offset > max {
+		offset = st.Size() - max
+	}
+	bs := make([]byte, st.Size()-offset)
+	n, _ := f.ReadAt(bs, offset)
+	return string(bs[:n])
 }
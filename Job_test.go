@@ -0,0 +1,285 @@
+package main
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func shellJobTest(t *testing.T, cb func(dir string, job *ShellJob)) {
+	if "windows" == runtime.GOOS {
+		t.Skip("the shell job test is only for the posix")
+	}
+
+	dir, e := ioutil.TempDir("", "sched_job")
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	cb(dir, &ShellJob{name: "abc",
+		execute: "/bin/sh",
+		timeout: 10 * time.Second,
+		logfile: filepath.Join(dir, "job_abc.log")})
+}
+
+func TestDirectoryOfJob(t *testing.T) {
+	shellJobTest(t, func(dir string, job *ShellJob) {
+		work_dir, e := filepath.EvalSymlinks(dir)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		job.directory = work_dir
+		job.arguments = []string{"-c", "pwd"}
+
+		run := job.do_run(newRunInstance(), 0)
+		if RUN_OK != run.status {
+			t.Error("status is error, ", run.status, run.log_excerpt)
+		}
+		if !strings.Contains(run.log_excerpt, "\n"+work_dir+"\n") {
+			t.Error("work directory is error, ", run.log_excerpt)
+		}
+
+		job.directory = filepath.Join(dir, "not_exists")
+		run = job.do_run(newRunInstance(), 0)
+		if RUN_FAILED != run.status {
+			t.Error("status is error, ", run.status)
+		}
+		if !strings.Contains(run.log_excerpt, "'"+job.directory+"' is not exists") {
+			t.Error("log is error, ", run.log_excerpt)
+		}
+	})
+}
+
+func TestRetryJob(t *testing.T) {
+	shellJobTest(t, func(dir string, job *ShellJob) {
+		job.arguments = []string{"-c", "echo attempt; exit 3"}
+		job.max_retries = 2
+		job.retry_delay = 10 * time.Millisecond
+		job.retry_backoff = 2
+
+		started_at := time.Now()
+		job.runWithRetries(newRunInstance())
+		if time.Now().Sub(started_at) < 30*time.Millisecond {
+			t.Error("retry delay is error, ", time.Now().Sub(started_at))
+		}
+
+		bs, e := ioutil.ReadFile(job.logfile)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 3 != strings.Count(string(bs), "attempt\n") {
+			t.Error("count of attempts is error, ", string(bs))
+		}
+		if !strings.Contains(string(bs), "begin(retry 2/2)") {
+			t.Error("retry is not logged, ", string(bs))
+		}
+	})
+}
+
+func waitJob(t *testing.T, job *ShellJob, timeout time.Duration) {
+	for started_at := time.Now(); job.isRunning(); time.Sleep(10 * time.Millisecond) {
+		if time.Now().Sub(started_at) > timeout {
+			t.Error("wait job timeout")
+			return
+		}
+	}
+}
+
+func TestConcurrencyOfJob(t *testing.T) {
+	for _, test := range []struct {
+		concurrency string
+		limit       int
+		begins      int
+		killed      int
+	}{{concurrency: CONCURRENCY_FORBID, begins: 1},
+		{concurrency: CONCURRENCY_ALLOW, begins: 3},
+		{concurrency: CONCURRENCY_ALLOW, limit: 2, begins: 2},
+		{concurrency: CONCURRENCY_REPLACE, begins: 3, killed: 2},
+		{concurrency: CONCURRENCY_QUEUE, begins: 3},
+		{concurrency: CONCURRENCY_QUEUE, limit: 1, begins: 2}} {
+		shellJobTest(t, func(dir string, job *ShellJob) {
+			job.arguments = []string{"-c", "sleep 0.2"}
+			job.concurrency = test.concurrency
+			job.concurrency_limit = test.limit
+
+			for i := 0; i < 3; i++ {
+				job.Run()
+				time.Sleep(20 * time.Millisecond)
+			}
+			waitJob(t, job, 5*time.Second)
+
+			bs, e := ioutil.ReadFile(job.logfile)
+			if nil != e {
+				t.Error(e)
+				return
+			}
+			if begins := strings.Count(string(bs), "= begin at "); test.begins != begins {
+				t.Error(test.concurrency, test.limit, "count of runs is error, ", begins)
+			}
+			if killed := strings.Count(string(bs), "run killed"); test.killed != killed {
+				t.Error(test.concurrency, test.limit, "count of killed is error, ", killed)
+			}
+		})
+	}
+}
+
+func TestRunResultOfJob(t *testing.T) {
+	shellJobTest(t, func(dir string, job *ShellJob) {
+		job.arguments = []string{"-c", "exit 3"}
+		job.runWithRetries(newRunInstance())
+
+		stats := job.Stats()
+		result, ok := stats["last_result"].(map[string]interface{})
+		if !ok {
+			t.Error("last result is missing, ", stats)
+			return
+		}
+		if 3 != result["exit_code"] || "" != result["signal"] || false != result["is_timeout"] {
+			t.Error("last result is error, ", result)
+		}
+
+		job.arguments = []string{"-c", "kill -9 $$"}
+		run := job.do_run(newRunInstance(), 0)
+		if RUN_FAILED != run.status || "killed" != run.Signal {
+			t.Error("signal is error, ", run.status, run.Signal)
+		}
+	})
+}
+
+func TestStatsOfJob(t *testing.T) {
+	shellJobTest(t, func(dir string, job *ShellJob) {
+		job.arguments = []string{"-c", "exit 1"}
+		job.max_retries = 1
+		job.runWithRetries(newRunInstance())
+
+		stats := job.Stats()
+		if 2 != stats["total_runs"] || 2 != stats["consecutive_failures"] || RUN_FAILED != stats["last_status"] {
+			t.Error("stats is error, ", stats)
+		}
+		if false != stats["running"] || nil != stats["pid"] {
+			t.Error("running is error, ", stats)
+		}
+
+		job.arguments = []string{"-c", "sleep 0.2"}
+		job.Run()
+		for started_at := time.Now(); nil == job.Stats()["pid"]; time.Sleep(10 * time.Millisecond) {
+			if time.Now().Sub(started_at) > time.Second {
+				t.Error("pid is missing, ", job.Stats())
+				break
+			}
+		}
+		waitJob(t, job, 5*time.Second)
+
+		stats = job.Stats()
+		if 3 != stats["total_runs"] || 0 != stats["consecutive_failures"] || RUN_OK != stats["last_status"] {
+			t.Error("stats is error, ", stats)
+		}
+	})
+}
+
+func TestPerRunLogOfJob(t *testing.T) {
+	shellJobTest(t, func(dir string, job *ShellJob) {
+		job.arguments = []string{"-c", "echo run"}
+		job.per_run_log = true
+		job.log_retention_count = 2
+
+		var runs []*jobRun
+		for i := 0; i < 3; i++ {
+			job.rotate_file()
+			runs = append(runs, job.do_run(newRunInstance(), 0))
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		for _, run := range runs {
+			if filepath.Join(dir, "job_abc") != filepath.Dir(run.log_file) {
+				t.Error("log file is error, ", run.log_file)
+			}
+		}
+		if fileExists(job.logfile) {
+			t.Error("the shared log file is written")
+		}
+		if fileExists(runs[0].log_file) || !fileExists(runs[1].log_file) || !fileExists(runs[2].log_file) {
+			t.Error("retention is error")
+		}
+		if runs[2].log_file != job.currentLogFile() {
+			t.Error("current log file is error, ", job.currentLogFile())
+		}
+
+		bs, e := ioutil.ReadFile(runs[2].log_file)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 1 != strings.Count(string(bs), "= begin at ") || !strings.Contains(string(bs), "run\n") {
+			t.Error("log is error, ", string(bs))
+		}
+	})
+}
+
+func TestRotateLogOfJob(t *testing.T) {
+	shellJobTest(t, func(dir string, job *ShellJob) {
+		job.log_max_bytes = 4
+		job.log_max_num = 2
+		job.log_compress = true
+
+		for _, s := range []string{"1234", "5678", "abcd"} {
+			if e := ioutil.WriteFile(job.logfile, []byte(s), 0666); nil != e {
+				t.Error(e)
+				return
+			}
+			if e := job.rotate_file(); nil != e {
+				t.Error(e)
+				return
+			}
+		}
+
+		if fileExists(job.logfile) || fileExists(job.logfile+".0001") || fileExists(job.logfile+".0003.gz") {
+			t.Error("rotate is error")
+		}
+		for num, excepted := range map[int]string{1: "abcd", 2: "5678"} {
+			name := rotatedFile(job.logfile, num)
+			if job.logfile+".000"+strconv.Itoa(num)+".gz" != name {
+				t.Error("rotated file is error, ", name)
+				continue
+			}
+			f, e := os.Open(name)
+			if nil != e {
+				t.Error(e)
+				continue
+			}
+			r, e := gzip.NewReader(f)
+			if nil != e {
+				f.Close()
+				t.Error(e)
+				continue
+			}
+			bs, _ := ioutil.ReadAll(r)
+			f.Close()
+			if excepted != string(bs) {
+				t.Error("content of", name, "is error, ", string(bs))
+			}
+		}
+
+		job.log_max_bytes = 1024
+		job.log_daily = true
+		ioutil.WriteFile(job.logfile, []byte("yesterday"), 0666)
+		if e := job.rotate_file(); nil != e || !fileExists(job.logfile) {
+			t.Error("it is rotated while the file is written today, ", e)
+		}
+		yesterday := time.Now().AddDate(0, 0, -1)
+		os.Chtimes(job.logfile, yesterday, yesterday)
+		if e := job.rotate_file(); nil != e || fileExists(job.logfile) {
+			t.Error("it isn't rotated daily, ", e)
+		}
+	})
+}
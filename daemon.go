@@ -13,9 +13,13 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"text/template"
 	"time"
 )
@@ -28,6 +32,9 @@ var (
 	config_file   = flag.String("config", "./<program_name>.conf", "the config file path")
 	java_home     = flag.String("java_home", "", "the path of java, should auto search if it is empty")
 	log_path      = flag.String("log_path", "", "the path of log, should auto search if it is empty")
+	is_validate   = flag.Bool("validate", false, "validate the job files(or the ids of jobs in the db) in the arguments and exit, all jobs are validated if it is empty")
+	preview_spec  = flag.String("preview", "", "print the next activation times of the expression(or the job file, or the id of job in the db) and exit")
+	preview_count = flag.Int("preview_count", 10, "the count of the activation times for the preview")
 )
 
 func fileExists(nm string) bool {
@@ -64,7 +71,7 @@ func abs(s string) string {
 
 func main() {
 	flag.Parse()
-	if nil != flag.Args() && 0 != len(flag.Args()) {
+	if !*is_validate && nil != flag.Args() && 0 != len(flag.Args()) {
 		flag.Usage()
 		return
 	}
@@ -106,13 +113,59 @@ func main() {
 	}
 	flag.Set("log_path", ensureLogPath(*root_dir, arguments))
 
+	job_directories := []string{filepath.Join(*root_dir, "lib", "jobs")}
+	if *is_validate {
+		if !runValidate(flag.Args(), job_directories, arguments) {
+			os.Exit(1)
+		}
+		return
+	}
+	if "" != *preview_spec {
+		if !runPreview(*preview_spec, *preview_count, arguments) {
+			os.Exit(1)
+		}
+		return
+	}
+
 	backend, e := newBackend(*db_drv, *db_url)
 	if nil != e {
 		log.Println(e)
 		return
 	}
+	if e = backend.migrate(); nil != e {
+		log.Println("[sys]", e)
+		return
+	}
+
+	if 0 == *max_concurrency {
+		flag.Set("max_concurrency", fmt.Sprint(intWithDefault(arguments, "max_concurrency", 0)))
+	}
+	workers.setMax(*max_concurrency)
+	if e = setupNotifiers(arguments); nil != e {
+		log.Println(e)
+		return
+	}
+	if 0 < *max_concurrency {
+		log.Println("[sys] max concurrency is", *max_concurrency)
+	}
+
+	if !*db_lock {
+		flag.Set("db_lock", fmt.Sprint(boolWithDefault(arguments, "db_lock", false)))
+	}
+	if 0 == *db_lock_expiry {
+		flag.Set("db_lock_expiry", durationWithDefault(arguments, "db_lock_expiry", 5*time.Minute).String())
+	}
+	if "" == *db_lock_owner {
+		flag.Set("db_lock_owner", stringWithDefault(arguments, "db_lock_owner", lockOwner()))
+	}
+	if *db_lock {
+		if e = backend.createLocksTable(); nil != e {
+			log.Println("[sys]", e)
+			return
+		}
+		log.Println("[sys] the db jobs are locked by '" + *db_lock_owner + "', the lease is expired after " + db_lock_expiry.String())
+	}
 
-	job_directories := []string{filepath.Join(*root_dir, "lib", "jobs")}
 	jobs_from_dir, e := loadJobsFromDirectory(job_directories, arguments)
 	if nil != e {
 		log.Println(e)
@@ -124,22 +177,33 @@ func main() {
 		return
 	}
 
-	error_jobs := map[string]error{}
+	error_jobs := newErrorJobs(nil)
 	cr := cron.New()
 	for _, job := range jobs_from_dir {
-		sch, e := Parse(job.expression)
+		job.backend = backend
+		sch, e := scheduleOf(job)
 		if nil != e {
-			error_jobs[job.name] = e
+			error_jobs.set(job.name, e)
 			log.Println("["+job.name+"] schedule failed,", e)
 			continue
 		}
+		if e := checkCycle(cr, job.name, job); nil != e {
+			error_jobs.set(job.name, e)
+			log.Println(e)
+			continue
+		}
 		cr.Schedule(job.name, sch, job)
 	}
 	for _, job := range jobs_from_db {
-		sch, e := Parse(job.expression)
+		sch, e := scheduleOf(&job.ShellJob)
 		if nil != e {
 			e := errors.New("[" + job.name + "] schedule failed, " + e.Error())
-			error_jobs[fmt.Sprint(job.id)] = e
+			error_jobs.set(fmt.Sprint(job.id), e)
+			log.Println(e)
+			continue
+		}
+		if e := checkCycle(cr, fmt.Sprint(job.id), &job.ShellJob); nil != e {
+			error_jobs.set(fmt.Sprint(job.id), e)
 			log.Println(e)
 			continue
 		}
@@ -147,20 +211,24 @@ func main() {
 	}
 
 	expvar.Publish("jobs", expvar.Func(func() interface{} {
-		ret := map[string]interface{}{}
-		for nm, e := range error_jobs {
+		ret := map[string]interface{}{"@pool": workers.stats()}
+		for nm, e := range error_jobs.snapshot() {
 			ret[nm] = e.Error()
 		}
 
 		for _, ent := range cr.Entries() {
+			var m map[string]interface{}
 			if export, ok := ent.Job.(Exportable); ok {
-				m := export.Stats()
+				m = export.Stats()
 				m["next"] = ent.Next
 				m["prev"] = ent.Prev
-				ret[ent.Id] = m
 			} else {
-				ret[ent.Id] = map[string]interface{}{"next": ent.Next, "prev": ent.Prev}
+				m = map[string]interface{}{"next": ent.Next, "prev": ent.Prev}
 			}
+			if job, _ := toShellJob(ent.Job); nil != job {
+				m["waiting"] = atomic.LoadInt32(&job.waiting)
+			}
+			ret[ent.Id] = m
 		}
 
 		bs, e := json.MarshalIndent(ret, "", "  ")
@@ -171,8 +239,25 @@ func main() {
 		return &rm
 	}))
 
+	if !*web_edit {
+		flag.Set("web_edit", fmt.Sprint(boolWithDefault(arguments, "web_edit", false)))
+	}
+	web := &webServer{cr: cr, error_jobs: error_jobs, backend: backend, arguments: arguments, is_editable: *web_edit}
+	http.Handle("/jobs", web)
+	http.Handle("/jobs/", web)
+	http.HandleFunc("/preview", web.preview)
+	http.HandleFunc("/", web.dashboard)
+	http.Handle("/metrics", &metricsServer{cr: cr, error_jobs: error_jobs})
+
+	if 0 == *shutdown_timeout {
+		flag.Set("shutdown_timeout", durationWithDefault(arguments, "shutdown_timeout", 1*time.Minute).String())
+	}
+	if 0 == *kill_grace {
+		flag.Set("kill_grace", durationWithDefault(arguments, "kill_grace", 5*time.Second).String())
+	}
+
+	jobs_cron = cr
 	cr.Start()
-	defer cr.Stop()
 
 	watcher, e := fsnotify.NewWatcher()
 	if e != nil {
@@ -190,45 +275,60 @@ func main() {
 					log.Println("[sys] new job -", nm)
 					job, e := loadJobFromFile(ev.Name, arguments)
 					if nil != e {
-						error_jobs[nm] = e
+						error_jobs.set(nm, e)
 						log.Println("["+nm+"] schedule failed,", e)
 						break
 					}
-					sch, e := Parse(job.expression)
+					job.backend = backend
+					sch, e := scheduleOf(job)
 					if nil != e {
-						error_jobs[job.name] = e
+						error_jobs.set(job.name, e)
 						log.Println("["+job.name+"] schedule failed,", e)
 						break
 					}
+					if e := checkCycle(cr, job.name, job); nil != e {
+						error_jobs.set(job.name, e)
+						log.Println(e)
+						break
+					}
 					cr.Schedule(job.name, sch, job)
 				} else if ev.IsDelete() {
 					nm := strings.ToLower(filepath.Base(ev.Name))
 					log.Println("[sys] delete job -", nm)
 					cr.Unschedule(nm)
-					delete(error_jobs, nm)
+					error_jobs.remove(nm)
 				} else if ev.IsModify() {
 					nm := strings.ToLower(filepath.Base(ev.Name))
 					log.Println("[sys] reload job -", nm)
 					cr.Unschedule(nm)
-					delete(error_jobs, nm)
+					error_jobs.remove(nm)
 					job, e := loadJobFromFile(ev.Name, arguments)
 					if nil != e {
-						error_jobs[nm] = e
+						error_jobs.set(nm, e)
 						log.Println("["+nm+"] schedule failed,", e)
 						break
 					}
-					sch, e := Parse(job.expression)
+					job.backend = backend
+					sch, e := scheduleOf(job)
 					if nil != e {
-						error_jobs[job.name] = e
+						error_jobs.set(job.name, e)
 						log.Println("["+job.name+"] schedule failed,", e)
 						break
 					}
+					if e := checkCycle(cr, job.name, job); nil != e {
+						error_jobs.set(job.name, e)
+						log.Println(e)
+						break
+					}
 					cr.Schedule(job.name, sch, job)
 				}
 			case err := <-watcher.Error:
 				log.Println("error:", err)
 			case <-time.After(*poll_interval):
-				if e := reloadJobsFromDB(cr, error_jobs, backend, arguments); nil != e {
+				started_at := time.Now()
+				e := reloadJobsFromDB(cr, error_jobs, backend, arguments)
+				db_poll.observe(time.Now().Sub(started_at), e)
+				if nil != e {
 					log.Println(e)
 				}
 			}
@@ -244,13 +344,31 @@ func main() {
 	}
 
 	log.Println("[schd-jobs] serving at '" + *listenAddress + "'")
-	e = http.ListenAndServe(*listenAddress, nil)
-	if e != nil {
-		log.Fatal(e)
+	srv := &http.Server{Addr: *listenAddress}
+	srv_error := make(chan error, 1)
+	go func() {
+		srv_error <- srv.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	select {
+	case e = <-srv_error:
+		log.Println(e)
+	case sig := <-signals:
+		log.Println("[sys] receive signal -", sig, ", shutdown...")
+		srv.Close()
+	}
+
+	shutdown(cr, *shutdown_timeout)
+	watcher.Close()
+	backend.Close()
+	if nil != e {
+		os.Exit(1)
 	}
 }
 
-func reloadJobsFromDB(cr *cron.Cron, error_jobs map[string]error, backend *dbBackend, arguments map[string]interface{}) error {
+func reloadJobsFromDB(cr *cron.Cron, error_jobs *errorJobs, backend *dbBackend, arguments map[string]interface{}) error {
 	jobs, e := backend.snapshot(nil)
 	if nil != e {
 		return errors.New("load snapshot from db failed, " + e.Error())
@@ -270,7 +388,7 @@ func reloadJobsFromDB(cr *cron.Cron, error_jobs map[string]error, backend *dbBac
 			} else {
 				log.Println("[sys] delete job -", job.name)
 				cr.Unschedule(fmt.Sprint(job.id))
-				delete(error_jobs, fmt.Sprint(job.id))
+				error_jobs.remove(fmt.Sprint(job.id))
 			}
 		}
 	}
@@ -281,7 +399,7 @@ func reloadJobsFromDB(cr *cron.Cron, error_jobs map[string]error, backend *dbBac
 	return nil
 }
 
-func reloadJobFromDB(cr *cron.Cron, error_jobs map[string]error, backend *dbBackend, arguments map[string]interface{}, id int64, name string) {
+func reloadJobFromDB(cr *cron.Cron, error_jobs *errorJobs, backend *dbBackend, arguments map[string]interface{}, id int64, name string) {
 	message_prefix := "[sys] reload job -"
 	if "" == name {
 		message_prefix = "[sys] load new job -"
@@ -305,18 +423,73 @@ func reloadJobFromDB(cr *cron.Cron, error_jobs map[string]error, backend *dbBack
 	id_str := fmt.Sprint(id)
 	log.Println(message_prefix, job.name)
 	cr.Unschedule(id_str)
-	delete(error_jobs, id_str)
+	error_jobs.remove(id_str)
 
-	sch, e := Parse(job.expression)
+	sch, e := scheduleOf(&job.ShellJob)
 	if nil != e {
 		msg := errors.New("[" + job.name + "] schedule failed," + e.Error())
-		error_jobs[id_str] = msg
+		error_jobs.set(id_str, msg)
 		log.Println(msg)
 		return
 	}
+	if e := checkCycle(cr, id_str, &job.ShellJob); nil != e {
+		error_jobs.set(id_str, e)
+		log.Println(e)
+		return
+	}
 	cr.Schedule(id_str, sch, job)
 }
 
+// errorJobs is the errors of the jobs that are failed to load, it is written
+// by the watcher and read by the http handlers.
+type errorJobs struct {
+	lock sync.RWMutex
+	errs map[string]error
+}
+
+func newErrorJobs(errs map[string]error) *errorJobs {
+	if nil == errs {
+		errs = map[string]error{}
+	}
+	return &errorJobs{errs: errs}
+}
+
+func (self *errorJobs) set(id string, e error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.errs[id] = e
+}
+
+func (self *errorJobs) remove(id string) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	delete(self.errs, id)
+}
+
+func (self *errorJobs) get(id string) (error, bool) {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	e, ok := self.errs[id]
+	return e, ok
+}
+
+func (self *errorJobs) count() int {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	return len(self.errs)
+}
+
+// snapshot returns a copy of the errors.
+func (self *errorJobs) snapshot() map[string]error {
+	self.lock.RLock()
+	defer self.lock.RUnlock()
+	errs := make(map[string]error, len(self.errs))
+	for id, e := range self.errs {
+		errs[id] = e
+	}
+	return errs
+}
+
 func Parse(spec string) (sch cron.Schedule, e error) {
 	defer func() {
 		if o := recover(); nil != o {
@@ -413,9 +586,21 @@ func afterLoad(job *JobFromDB, arguments map[string]interface{}) error {
 				}
 			}
 		}
-
-		job.logfile = filepath.Join(*log_path, "job_"+job.name+".log")
 	}
+	job.logfile = filepath.Join(*log_path, "job_"+job.name+".log")
+	// the log options of the job override the global options.
+	options := []map[string]interface{}{job.log_options, arguments}
+	job.per_run_log = boolWithArguments(options, "per_run_log", false)
+	job.log_retention_count = intWithArguments(options, "log_retention_count", 0)
+	job.log_retention_age = durationWithArguments(options, "log_retention_age", 0)
+	job.log_max_bytes = int64(intWithArguments(options, "log_max_bytes", maxBytes))
+	job.log_max_num = intWithArguments(options, "log_max_num", maxNum)
+	job.log_compress = boolWithArguments(options, "log_compress", false)
+	job.log_daily = "daily" == strings.ToLower(stringWithArguments(options, "log_rotate", ""))
+	job.output = strings.ToLower(stringWithArguments(options, "output", OUTPUT_MERGED))
+	job.stderr_tail_bytes = intWithArguments(options, "stderr_tail_bytes", defaultStderrTailBytes)
+	job.log_timestamp = boolWithArguments(options, "log_timestamp", false)
+	job.on_idle = job.releaseLease
 	if nil != job.environments {
 		for idx, s := range job.environments {
 			job.environments[idx] = executeTemplate(s, arguments)
@@ -485,6 +670,14 @@ func executeTemplate(s string, args map[string]interface{}) string {
 }
 
 func loadJobFromFile(file string, args map[string]interface{}) (*ShellJob, error) {
+	value, e := readJobFile(file, args)
+	if nil != e {
+		return nil, e
+	}
+	return loadJobFromMap(file, []map[string]interface{}{value, args})
+}
+
+func readJobFile(file string, args map[string]interface{}) (map[string]interface{}, error) {
 	t, e := template.ParseFiles(file)
 	if nil != e {
 		return nil, errors.New("read file failed, " + e.Error())
@@ -506,27 +699,32 @@ func loadJobFromFile(file string, args map[string]interface{}) (*ShellJob, error
 		return nil, errors.New("ummarshal file failed, " + e.Error())
 	}
 	if value, ok := v.(map[string]interface{}); ok {
-		return loadJobFromMap(file, []map[string]interface{}{value, args})
+		return value, nil
 	}
 	return nil, fmt.Errorf("it is not a map or array - %T", v)
 }
 
 func loadJobFromMap(file string, args []map[string]interface{}) (*ShellJob, error) {
+	var errs validationErrors
 	name := strings.ToLower(filepath.Base(file))
 	if 0 == len(name) {
-		return nil, errors.New("'name' is missing.")
+		errs.add("name", "is missing.")
 	}
 	expression := stringWithArguments(args, "expression", "")
-	if "" == expression {
-		return nil, errors.New("'expression' is missing.")
+	depends_on := trimStrings(stringsWithArguments(args[:1], "depends_on", ",", nil, false))
+	// the job without expression is only run by the upstream jobs, the steps
+	// of a workflow inherit depends_on of the workflow.
+	if "" == expression && 0 == len(stringsWithArguments(args, "depends_on", ",", nil, false)) {
+		errs.add("expression", "is missing, it is required if depends_on is empty.")
 	}
 	timeout := durationWithArguments(args, "timeout", 10*time.Minute)
 	if timeout <= 0*time.Second {
-		return nil, errors.New("'killTimeout' must is greate 0s.")
+		errs.add("timeout", "must is greate 0s.")
 	}
+	is_workflow := JOB_WORKFLOW == stringWithDefault(args[0], "type", "")
 	proc := stringWithArguments(args, "execute", "")
-	if 0 == len(proc) {
-		return nil, errors.New("'execute' is missing.")
+	if 0 == len(proc) && !is_workflow {
+		errs.add("execute", "is missing.")
 	}
 	arguments := stringsWithArguments(args, "arguments", "", nil, false)
 	environments := stringsWithArguments(args, "environments", "", nil, false)
@@ -540,24 +738,57 @@ func loadJobFromMap(file string, args []map[string]interface{}) (*ShellJob, erro
 		var e error
 		arguments, e = loadJavaArguments(arguments, args)
 		if nil != e {
-			return nil, e
+			errs.add("java_classpath", "load failed, "+e.Error())
 		}
 
 		if "java" == proc || "java.exe" == proc {
 			proc = *java_home
 		}
 	}
+	if 0 != len(errs) {
+		return nil, errs
+	}
 
 	logfile := filepath.Join(*log_path, "job_"+name+".log")
-	return &ShellJob{name: name,
-		timeout:      timeout,
-		expression:   expression,
-		execute:      proc,
-		directory:    directory,
-		environments: environments,
-		arguments:    arguments,
-		logfile:      logfile}, nil
+	job := &ShellJob{name: name,
+		timeout:             timeout,
+		expression:          expression,
+		execute:             proc,
+		directory:           directory,
+		environments:        environments,
+		arguments:           arguments,
+		logfile:             logfile,
+		max_retries:         intWithArguments(args, "max_retries", 0),
+		retry_delay:         durationWithArguments(args, "retry_delay", defaultRetryDelay),
+		retry_backoff:       floatWithArguments(args, "retry_backoff", defaultRetryBackoff),
+		concurrency:         strings.ToLower(stringWithArguments(args, "concurrency", CONCURRENCY_FORBID)),
+		concurrency_limit:   intWithArguments(args, "concurrency_limit", 0),
+		priority:            intWithArguments(args[:1], "priority", 0),
+		per_run_log:         boolWithArguments(args, "per_run_log", false),
+		log_retention_count: intWithArguments(args, "log_retention_count", 0),
+		log_retention_age:   durationWithArguments(args, "log_retention_age", 0),
+		log_max_bytes:       int64(intWithArguments(args, "log_max_bytes", maxBytes)),
+		log_max_num:         intWithArguments(args, "log_max_num", maxNum),
+		log_compress:        boolWithArguments(args, "log_compress", false),
+		log_daily:           "daily" == strings.ToLower(stringWithArguments(args, "log_rotate", "")),
+		output:              strings.ToLower(stringWithArguments(args, "output", OUTPUT_MERGED)),
+		stderr_tail_bytes:   intWithArguments(args, "stderr_tail_bytes", defaultStderrTailBytes),
+		log_timestamp:       boolWithArguments(args, "log_timestamp", false),
+		notify_to:           trimStrings(stringsWithArguments(args[:1], "notify_to", ",", nil, false)),
+		webhooks:            trimStrings(stringsWithArguments(args[:1], "webhooks", ",", nil, false)),
+		depends_on:          depends_on,
+		on_success:          trimStrings(stringsWithArguments(args[:1], "on_success", ",", nil, false)),
+		on_failure:          trimStrings(stringsWithArguments(args[:1], "on_failure", ",", nil, false))}
+	if is_workflow {
+		var step_errs validationErrors
+		job.workflow, step_errs = loadWorkflow(job, args)
+		if 0 != len(step_errs) {
+			return nil, step_errs
+		}
+	}
+	return job, nil
 }
+
 func loadJavaClasspath(cp []string) ([]string, error) {
 	if nil != cp && 0 != len(cp) {
 		return nil, nil
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/runner-mei/cron"
+)
+
+var dashboardTemplate = template.Must(template.New("dashboard").Funcs(template.FuncMap{
+	"datetime": func(t time.Time) string {
+		if t.IsZero() {
+			return "-"
+		}
+		return t.Format("2006-01-02 15:04:05")
+	}}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>scheduler</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 20px; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 20px; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; }
+th { background: #eee; }
+.ok { color: green; }
+.failed, .timeout, .error { color: red; }
+.running { color: blue; }
+</style>
+<script>
+function action(id, name) {
+  var req = new XMLHttpRequest();
+  req.open("POST", "jobs/" + encodeURIComponent(id) + "/" + name, true);
+  req.onreadystatechange = function() {
+    if (4 != req.readyState) {
+      return;
+    }
+    if (req.status >= 300) {
+      alert(req.responseText);
+    }
+    window.location.reload();
+  };
+  req.send();
+}
+</script>
+</head>
+<body>
+<h2>Jobs</h2>
+<table>
+<tr><th>id</th><th>name</th><th>source</th><th>expression</th><th>next</th><th>prev</th><th>status</th><th>last result</th><th></th></tr>
+{{range .jobs}}
+<tr>
+<td>{{.id}}</td>
+<td>{{.name}}</td>
+<td>{{.source}}</td>
+<td>{{.expression}}</td>
+<td>{{datetime .next}}</td>
+<td>{{datetime .prev}}</td>
+<td>{{if .running}}<span class="running">running</span>{{else}}idle{{end}}</td>
+<td>{{if .last_status}}<span class="{{.last_status}}">{{.last_status}}</span>, exit code {{.exit_code}}{{if .signal}}, signal {{.signal}}{{end}}, at {{datetime .last_end_at}}{{else}}-{{end}}</td>
+<td>
+<button onclick="action('{{.id}}', 'run')">run</button>
+<button onclick="action('{{.id}}', 'kill')"{{if not .running}} disabled{{end}}>kill</button>
+{{if .logfile}}<a href="jobs/{{.id}}/log">log</a>{{end}}
+</td>
+</tr>
+{{else}}
+<tr><td colspan="9">no job is scheduled.</td></tr>
+{{end}}
+</table>
+{{if .errors}}
+<h2>Load errors</h2>
+<table>
+<tr><th>id</th><th>error</th></tr>
+{{range .errors}}
+<tr><td>{{.id}}</td><td class="error">{{.error}}</td></tr>
+{{end}}
+</table>
+{{end}}
+</body>
+</html>
+`))
+
+func dashboardJob(ent *cron.Entry) map[string]interface{} {
+	info := map[string]interface{}{"id": ent.Id,
+		"next": ent.Next,
+		"prev": ent.Prev}
+	job, source := toShellJob(ent.Job)
+	if nil == job {
+		return info
+	}
+	info["source"] = source
+	info["name"] = job.name
+	info["expression"] = job.expression
+	info["logfile"] = job.logfile
+
+	job.lock.Lock()
+	defer job.lock.Unlock()
+	info["running"] = 0 != len(job.instances)
+	if 0 != job.total_runs {
+		info["last_status"] = job.last_status
+		info["last_end_at"] = job.last_end_at
+	}
+	if nil != job.last_result {
+		info["exit_code"] = job.last_result.ExitCode
+		info["signal"] = job.last_result.Signal
+	}
+	return info
+}
+
+// dashboard renders the status of all jobs as a html page, it is mounted at
+// '/'.
+func (self *webServer) dashboard(w http.ResponseWriter, r *http.Request) {
+	if "/" != r.URL.Path {
+		http.NotFound(w, r)
+		return
+	}
+
+	jobs := make([]map[string]interface{}, 0, 10)
+	for _, ent := range self.cr.Entries() {
+		jobs = append(jobs, dashboardJob(ent))
+	}
+
+	load_errors := make([]map[string]string, 0, self.error_jobs.count())
+	for id, e := range self.error_jobs.snapshot() {
+		load_errors = append(load_errors, map[string]string{"id": id, "error": e.Error()})
+	}
+	sort.Slice(load_errors, func(i, j int) bool { return load_errors[i]["id"] < load_errors[j]["id"] })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	if e := dashboardTemplate.Execute(w, map[string]interface{}{"jobs": jobs, "errors": load_errors}); nil != e {
+		w.Write([]byte(e.Error()))
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/cron"
+)
+
+func TestDashboard(t *testing.T) {
+	job := &ShellJob{name: "abc", expression: "@every 1h", logfile: "job_abc.log"}
+	now := time.Now()
+	job.record(&jobRun{begin_at: now, end_at: now, status: RUN_FAILED, RunResult: RunResult{ExitCode: 3}})
+
+	cr := cron.New()
+	sch, e := Parse(job.expression)
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	cr.Schedule("abc.json", sch, job)
+
+	srv := &webServer{cr: cr, error_jobs: newErrorJobs(map[string]error{"<b>.json": errors.New("load failed")})}
+	w := httptest.NewRecorder()
+	srv.dashboard(w, httptest.NewRequest("GET", "/", nil))
+
+	body := w.Body.String()
+	for _, s := range []string{"<td>abc.json</td>",
+		"<td>@every 1h</td>",
+		"<span class=\"failed\">failed</span>, exit code 3",
+		"<a href=\"jobs/abc.json/log\">log</a>",
+		"<td>&lt;b&gt;.json</td><td class=\"error\">load failed</td>"} {
+		if !strings.Contains(body, s) {
+			t.Error("'"+s+"' is missing, ", body)
+		}
+	}
+
+	w = httptest.NewRecorder()
+	srv.dashboard(w, httptest.NewRequest("GET", "/abc", nil))
+	if 404 != w.Code {
+		t.Error("status code is error, ", w.Code)
+	}
+}
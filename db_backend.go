@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"database/sql"
 	"database/sql/driver"
+	"encoding/json"
 
 	"errors"
 	"flag"
@@ -30,10 +31,12 @@ const (
 )
 
 var (
-	db_url     = flag.String("db_url", "host=127.0.0.1 dbname=tpt_models_test user=tpt password=extreme sslmode=disable", "the db url")
-	db_drv     = flag.String("db_drv", "postgres", "the db driver")
-	db_type    = flag.Int("db_type", AUTO, "the db type, 0 is auto")
-	table_name = flag.String("db_table", "sched_jobs", "the table name for jobs")
+	db_url      = flag.String("db_url", "host=127.0.0.1 dbname=tpt_models_test user=tpt password=extreme sslmode=disable", "the db url")
+	db_drv      = flag.String("db_drv", "postgres", "the db driver")
+	db_type     = flag.Int("db_type", AUTO, "the db type, 0 is auto")
+	table_name  = flag.String("db_table", "sched_jobs", "the table name for jobs")
+	runs_table  = flag.String("db_runs_table", "sched_job_runs", "the table name for the run history of jobs")
+	locks_table = flag.String("db_locks_table", "sched_locks", "the table name for the leases of jobs")
 
 	is_test_for_lock = false
 	test_ch_for_lock = make(chan int)
@@ -58,6 +61,10 @@ func SetTable(table_name string) {
 	flag.Set("db_table", table_name)
 }
 
+func SetRunsTable(table_name string) {
+	flag.Set("db_runs_table", table_name)
+}
+
 func SetDbUrl(drv, url string) {
 	flag.Set("db_url", url)
 	flag.Set("db_drv", drv)
@@ -160,7 +167,7 @@ func newBackend(drvName, url string) (*dbBackend, error) {
 		return nil, e
 	}
 	return &dbBackend{drv: drv, db: db, dbType: DbType(drvName),
-		select_sql_string: "SELECT id, name, expression, execute, directory, arguments, environments, kill_after_interval, created_at, updated_at FROM " + *table_name + " "}, nil
+		select_sql_string: "SELECT id, name, expression, execute, directory, arguments, environments, kill_after_interval, max_retries, retry_delay, retry_backoff, concurrency, concurrency_limit, priority, notify_to, webhooks, depends_on, on_success, on_failure, log_options, created_at, updated_at FROM " + *table_name + " "}, nil
 }
 
 func (self *dbBackend) Close() error {
@@ -201,10 +208,10 @@ func buildSQL(dbType int, params map[string]interface{}) (string, []interface{},
 		switch dbType {
 		case ORACLE:
 			buffer.WriteString(" = :")
-			buffer.WriteString(strconv.FormatInt(int64(len(params)+1), 10))
+			buffer.WriteString(strconv.FormatInt(int64(len(arguments)+1), 10))
 		case POSTGRESQL:
 			buffer.WriteString(" = $")
-			buffer.WriteString(strconv.FormatInt(int64(len(params)+1), 10))
+			buffer.WriteString(strconv.FormatInt(int64(len(arguments)+1), 10))
 		default:
 			buffer.WriteString(" = ? ")
 		}
@@ -336,54 +343,10 @@ func (self *dbBackend) where(params map[string]interface{}) ([]*JobFromDB, error
 
 	var results []*JobFromDB
 	for rows.Next() {
-
-		job := new(JobFromDB)
-		var directory sql.NullString
-		var arguments sql.NullString
-		var environments sql.NullString
-		var kill_after_interval sql.NullInt64
-		var created_at NullTime
-		var updated_at NullTime
-
-		e = rows.Scan(
-			&job.id,
-			&job.name,
-			&job.expression,
-			&job.execute,
-			&directory,
-			&arguments,
-			&environments,
-			&kill_after_interval,
-			&created_at,
-			&updated_at)
+		job, e := self.scanJob(rows)
 		if nil != e {
-			return nil, i18n(self.dbType, self.drv, e)
-		}
-
-		if directory.Valid {
-			job.directory = directory.String
-		}
-
-		if arguments.Valid && "" != arguments.String {
-			job.arguments = SplitLines(arguments.String) // arguments.String
-		}
-
-		if environments.Valid && "" != environments.String {
-			job.environments = SplitLines(environments.String) // environments.String
+			return nil, e
 		}
-
-		if kill_after_interval.Valid {
-			job.timeout = time.Duration(kill_after_interval.Int64) * time.Second
-		}
-
-		if created_at.Valid {
-			job.created_at = created_at.Time
-		}
-
-		if updated_at.Valid {
-			job.updated_at = updated_at.Time
-		}
-
 		results = append(results, job)
 	}
 
@@ -406,11 +369,31 @@ func (self *dbBackend) find(id int64) (*JobFromDB, error) {
 		row = self.db.QueryRow(self.select_sql_string+"where id = ?", id)
 	}
 
+	return self.scanJob(row)
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func (self *dbBackend) scanJob(row scanner) (*JobFromDB, error) {
 	job := new(JobFromDB)
 	var directory sql.NullString
 	var arguments sql.NullString
 	var environments sql.NullString
 	var kill_after_interval sql.NullInt64
+	var max_retries sql.NullInt64
+	var retry_delay sql.NullInt64
+	var retry_backoff sql.NullFloat64
+	var concurrency sql.NullString
+	var concurrency_limit sql.NullInt64
+	var priority sql.NullInt64
+	var notify_to sql.NullString
+	var webhooks sql.NullString
+	var depends_on sql.NullString
+	var on_success sql.NullString
+	var on_failure sql.NullString
+	var log_options sql.NullString
 	var created_at NullTime
 	var updated_at NullTime
 
@@ -423,6 +406,18 @@ func (self *dbBackend) find(id int64) (*JobFromDB, error) {
 		&arguments,
 		&environments,
 		&kill_after_interval,
+		&max_retries,
+		&retry_delay,
+		&retry_backoff,
+		&concurrency,
+		&concurrency_limit,
+		&priority,
+		&notify_to,
+		&webhooks,
+		&depends_on,
+		&on_success,
+		&on_failure,
+		&log_options,
 		&created_at,
 		&updated_at)
 	if nil != e {
@@ -445,6 +440,61 @@ func (self *dbBackend) find(id int64) (*JobFromDB, error) {
 		job.timeout = time.Duration(kill_after_interval.Int64) * time.Second
 	}
 
+	if max_retries.Valid {
+		job.max_retries = int(max_retries.Int64)
+	}
+
+	job.retry_delay = defaultRetryDelay
+	if retry_delay.Valid {
+		job.retry_delay = time.Duration(retry_delay.Int64) * time.Second
+	}
+
+	job.retry_backoff = defaultRetryBackoff
+	if retry_backoff.Valid {
+		job.retry_backoff = retry_backoff.Float64
+	}
+
+	job.concurrency = CONCURRENCY_FORBID
+	if concurrency.Valid && "" != concurrency.String {
+		job.concurrency = strings.ToLower(concurrency.String)
+	}
+
+	if concurrency_limit.Valid {
+		job.concurrency_limit = int(concurrency_limit.Int64)
+	}
+
+	if priority.Valid {
+		job.priority = int(priority.Int64)
+	}
+
+	if notify_to.Valid && "" != notify_to.String {
+		job.notify_to = trimStrings(strings.Split(notify_to.String, ","))
+	}
+
+	if webhooks.Valid && "" != webhooks.String {
+		job.webhooks = trimStrings(SplitLines(webhooks.String))
+	}
+
+	if depends_on.Valid && "" != depends_on.String {
+		job.depends_on = trimStrings(strings.Split(depends_on.String, ","))
+	}
+
+	if on_success.Valid && "" != on_success.String {
+		job.on_success = trimStrings(strings.Split(on_success.String, ","))
+	}
+
+	if on_failure.Valid && "" != on_failure.String {
+		job.on_failure = trimStrings(strings.Split(on_failure.String, ","))
+	}
+
+	if log_options.Valid && "" != log_options.String {
+		decoder := json.NewDecoder(strings.NewReader(log_options.String))
+		decoder.UseNumber()
+		if e := decoder.Decode(&job.log_options); nil != e {
+			return nil, errors.New("read log_options of '" + job.name + "' failed, " + e.Error())
+		}
+	}
+
 	if created_at.Valid {
 		job.created_at = created_at.Time
 	}
@@ -453,9 +503,130 @@ func (self *dbBackend) find(id int64) (*JobFromDB, error) {
 		job.updated_at = updated_at.Time
 	}
 
+	job.backend = self
 	return job, nil
 }
 
+// jobColumns returns the columns and the values of job for insert or update.
+func jobColumns(job *JobFromDB) ([]string, []interface{}) {
+	return []string{"name",
+			"expression",
+			"execute",
+			"directory",
+			"arguments",
+			"environments",
+			"kill_after_interval",
+			"max_retries",
+			"retry_delay",
+			"retry_backoff",
+			"concurrency",
+			"concurrency_limit",
+			"priority",
+			"notify_to",
+			"webhooks",
+			"depends_on",
+			"on_success",
+			"on_failure",
+			"log_options"},
+		[]interface{}{job.name,
+			job.expression,
+			job.execute,
+			job.directory,
+			strings.Join(job.arguments, "\n"),
+			strings.Join(job.environments, "\n"),
+			int64(job.timeout / time.Second),
+			job.max_retries,
+			int64(job.retry_delay / time.Second),
+			job.retry_backoff,
+			job.concurrency,
+			job.concurrency_limit,
+			job.priority,
+			strings.Join(job.notify_to, ","),
+			strings.Join(job.webhooks, "\n"),
+			strings.Join(job.depends_on, ","),
+			strings.Join(job.on_success, ","),
+			strings.Join(job.on_failure, ","),
+			logOptionsString(job.log_options)}
+}
+
+func logOptionsString(options map[string]interface{}) interface{} {
+	if 0 == len(options) {
+		return nil
+	}
+	bs, e := json.Marshal(options)
+	if nil != e {
+		return nil
+	}
+	return string(bs)
+}
+
+func (self *dbBackend) insert(job *JobFromDB) (int64, error) {
+	now := time.Now()
+	columns, arguments := jobColumns(job)
+	columns = append(columns, "created_at", "updated_at")
+	arguments = append(arguments, now, now)
+
+	placeholders := make([]string, len(columns))
+	for idx := range columns {
+		placeholders[idx] = parameterAt(self.dbType, idx+1)
+	}
+	query := "INSERT INTO " + *table_name + "(" + strings.Join(columns, ", ") + ") VALUES (" + strings.Join(placeholders, ", ") + ")"
+
+	var id int64
+	if POSTGRESQL == self.dbType {
+		e := self.db.QueryRow(query+" RETURNING id", arguments...).Scan(&id)
+		if nil != e {
+			return 0, i18n(self.dbType, self.drv, e)
+		}
+	} else {
+		res, e := self.db.Exec(query, arguments...)
+		if nil != e {
+			return 0, i18n(self.dbType, self.drv, e)
+		}
+		id, e = res.LastInsertId()
+		if nil != e {
+			return 0, i18n(self.dbType, self.drv, e)
+		}
+	}
+
+	job.id = id
+	job.created_at = now
+	job.updated_at = now
+	return id, nil
+}
+
+func (self *dbBackend) update(job *JobFromDB) error {
+	now := time.Now()
+	columns, arguments := jobColumns(job)
+	columns = append(columns, "updated_at")
+	arguments = append(arguments, now, job.id)
+
+	for idx := range columns {
+		columns[idx] = columns[idx] + " = " + parameterAt(self.dbType, idx+1)
+	}
+	res, e := self.db.Exec("UPDATE "+*table_name+" SET "+strings.Join(columns, ", ")+
+		" WHERE id = "+parameterAt(self.dbType, len(columns)+1), arguments...)
+	if nil != e {
+		return i18n(self.dbType, self.drv, e)
+	}
+	if affected, e := res.RowsAffected(); nil == e && 0 == affected {
+		return sql.ErrNoRows
+	}
+	job.updated_at = now
+	return nil
+}
+
+func (self *dbBackend) delete(id int64) error {
+	res, e := self.db.Exec("DELETE FROM "+*table_name+" WHERE id = "+parameterAt(self.dbType, 1), id)
+	if nil != e {
+		return i18n(self.dbType, self.drv, e)
+	}
+	if affected, e := res.RowsAffected(); nil == e && 0 == affected {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
 type version struct {
 	id         int64
 	updated_at time.Time
@@ -510,6 +681,357 @@ func (self *dbBackend) snapshot(params map[string]interface{}) ([]version, error
 	return results, nil
 }
 
+func parameterAt(dbType, idx int) string {
+	switch dbType {
+	case ORACLE:
+		return ":" + strconv.FormatInt(int64(idx), 10)
+	case POSTGRESQL:
+		return "$" + strconv.FormatInt(int64(idx), 10)
+	default:
+		return "?"
+	}
+}
+
+func (self *dbBackend) saveRun(run *jobRun) error {
+	var job_id interface{}
+	if 0 != run.job_id {
+		job_id = run.job_id
+	}
+
+	columns := []string{"job_id", "job_name", "attempt", "begin_at", "end_at", "status", "exit_code", "is_timeout", "log_excerpt", "log_file", "stderr_tail"}
+	placeholders := make([]string, len(columns))
+	for idx := range columns {
+		placeholders[idx] = parameterAt(self.dbType, idx+1)
+	}
+
+	_, e := self.db.Exec("INSERT INTO "+*runs_table+"("+strings.Join(columns, ", ")+") VALUES ("+strings.Join(placeholders, ", ")+")",
+		job_id,
+		run.job_name,
+		run.attempt,
+		run.begin_at,
+		run.end_at,
+		run.status,
+		run.ExitCode,
+		run.IsTimeout,
+		run.log_excerpt,
+		run.log_file,
+		run.stderr_tail)
+	if nil != e {
+		return i18n(self.dbType, self.drv, e)
+	}
+	return nil
+}
+
+// sqlType returns the column type of the db for the generic type.
+func (self *dbBackend) sqlType(typ string) string {
+	switch self.dbType {
+	case MYSQL:
+		switch typ {
+		case "timestamp":
+			return "datetime(6)"
+		case "real":
+			return "float"
+		}
+	case MSSQL:
+		switch typ {
+		case "timestamp":
+			return "datetime2"
+		case "text":
+			return "nvarchar(max)"
+		case "boolean":
+			return "bit"
+		}
+	}
+	return typ
+}
+
+// the columns that are added into the tables of jobs and runs after they are
+// created, they are added by migrate if they are missing.
+var (
+	jobsMigrations = []struct{ name, typ string }{{"max_retries", "integer"},
+		{"retry_delay", "integer"},
+		{"retry_backoff", "real"},
+		{"concurrency", "varchar(20)"},
+		{"concurrency_limit", "integer"},
+		{"priority", "integer"},
+		{"notify_to", "varchar(500)"},
+		{"webhooks", "varchar(1000)"},
+		{"depends_on", "varchar(500)"},
+		{"on_success", "varchar(500)"},
+		{"on_failure", "varchar(500)"},
+		{"log_options", "varchar(1000)"}}
+
+	runsMigrations = []struct{ name, typ string }{{"log_file", "varchar(500)"},
+		{"stderr_tail", "text"}}
+)
+
+// migrate creates the table of runs and adds the missing columns into the
+// tables of jobs and runs, it is idempotent.
+func (self *dbBackend) migrate() error {
+	if e := self.createRunsTable(); nil != e {
+		return e
+	}
+	for _, table := range []struct {
+		name    string
+		columns []struct{ name, typ string }
+	}{{*table_name, jobsMigrations}, {*runs_table, runsMigrations}} {
+		for _, column := range table.columns {
+			if e := self.addColumn(table.name, column.name, self.sqlType(column.typ)); nil != e {
+				return e
+			}
+		}
+	}
+	return nil
+}
+
+func (self *dbBackend) hasColumn(table, column string) bool {
+	rows, e := self.db.Query("SELECT " + column + " FROM " + table + " WHERE 1 = 0")
+	if nil != e {
+		return false
+	}
+	rows.Close()
+	return true
+}
+
+func (self *dbBackend) addColumn(table, column, typ string) error {
+	if self.hasColumn(table, column) {
+		return nil
+	}
+
+	var ddl string
+	switch self.dbType {
+	case MSSQL:
+		ddl = "ALTER TABLE " + table + " ADD " + column + " " + typ
+	case ORACLE:
+		ddl = "ALTER TABLE " + table + " ADD (" + column + " " + typ + ")"
+	default:
+		ddl = "ALTER TABLE " + table + " ADD COLUMN " + column + " " + typ
+	}
+	if _, e := self.db.Exec(ddl); nil != e {
+		return errors.New("add column '" + column + "' into table '" + table + "' failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	return nil
+}
+
+// createRunsTable creates the table of the run history if it is not exists.
+func (self *dbBackend) createRunsTable() error {
+	var id string
+	switch self.dbType {
+	case POSTGRESQL:
+		id = "id serial PRIMARY KEY"
+	case MYSQL:
+		id = "id bigint AUTO_INCREMENT PRIMARY KEY"
+	case MSSQL:
+		id = "id bigint IDENTITY(1,1) PRIMARY KEY"
+	default:
+		if self.hasColumn(*runs_table, "id") {
+			return nil
+		}
+		return errors.New("table '" + *runs_table + "' isn't exists, it must be created by hand for the db.")
+	}
+
+	columns := id + ", job_id bigint, job_name varchar(250) NOT NULL, attempt integer" +
+		", begin_at " + self.sqlType("timestamp") + ", end_at " + self.sqlType("timestamp") +
+		", status varchar(50), exit_code integer, is_timeout " + self.sqlType("boolean") +
+		", log_excerpt " + self.sqlType("text") + ", log_file varchar(500), stderr_tail " + self.sqlType("text")
+	ddl := "CREATE TABLE IF NOT EXISTS " + *runs_table + " (" + columns + ")"
+	if MSSQL == self.dbType {
+		ddl = "IF OBJECT_ID('" + *runs_table + "', 'U') IS NULL CREATE TABLE " + *runs_table + " (" + columns + ")"
+	}
+	if _, e := self.db.Exec(ddl); nil != e {
+		return errors.New("create table '" + *runs_table + "' failed, " + i18nString(self.dbType, self.drv, e))
+	}
+	return nil
+}
+
+// createLocksTable creates the table of the leases if it is not exists.
+func (self *dbBackend) createLocksTable() error {
+	var ddl string
+	switch self.dbType {
+	case POSTGRESQL:
+		ddl = "CREATE TABLE IF NOT EXISTS " + *locks_table + " (job_id bigint PRIMARY KEY, owner varchar(250) NOT NULL, fire_at timestamp, locked_at timestamp, expires_at timestamp)"
+	case MYSQL:
+		ddl = "CREATE TABLE IF NOT EXISTS " + *locks_table + " (job_id bigint PRIMARY KEY, owner varchar(250) NOT NULL, fire_at datetime(6), locked_at datetime(6), expires_at datetime(6))"
+	case MSSQL:
+		ddl = "IF OBJECT_ID('" + *locks_table + "', 'U') IS NULL CREATE TABLE " + *locks_table + " (job_id bigint PRIMARY KEY, owner varchar(250) NOT NULL, fire_at datetime2, locked_at datetime2, expires_at datetime2)"
+	}
+	if "" != ddl {
+		if _, e := self.db.Exec(ddl); nil != e {
+			return errors.New("create table '" + *locks_table + "' failed, " + i18nString(self.dbType, self.drv, e))
+		}
+	}
+
+	var count int64
+	if e := self.db.QueryRow("SELECT count(*) FROM " + *locks_table).Scan(&count); nil != e {
+		return errors.New("table '" + *locks_table + "' isn't available, " + i18nString(self.dbType, self.drv, e))
+	}
+	return nil
+}
+
+// acquireLock takes the lease of the job for the run that is fired at fire_at,
+// the lease is taken if the run of fire_at isn't taken yet and the lease isn't
+// held by the other(or it is expired). The owner of the lease is returned if
+// it isn't taken.
+func (self *dbBackend) acquireLock(job_id int64, owner string, fire_at, now, expires_at time.Time) (bool, string, error) {
+	res, e := self.db.Exec("UPDATE "+*locks_table+" SET owner = "+parameterAt(self.dbType, 1)+
+		", fire_at = "+parameterAt(self.dbType, 2)+
+		", locked_at = "+parameterAt(self.dbType, 3)+
+		", expires_at = "+parameterAt(self.dbType, 4)+
+		" WHERE job_id = "+parameterAt(self.dbType, 5)+
+		" AND (fire_at IS NULL OR fire_at < "+parameterAt(self.dbType, 6)+")"+
+		" AND (owner = "+parameterAt(self.dbType, 7)+" OR expires_at <= "+parameterAt(self.dbType, 8)+")",
+		owner, fire_at, now, expires_at, job_id, fire_at, owner, now)
+	if nil != e {
+		return false, "", i18n(self.dbType, self.drv, e)
+	}
+	if affected, e := res.RowsAffected(); nil == e && 0 != affected {
+		return true, owner, nil
+	}
+
+	if is_test_for_lock {
+		<-test_ch_for_lock
+	}
+
+	_, e = self.db.Exec("INSERT INTO "+*locks_table+"(job_id, owner, fire_at, locked_at, expires_at) VALUES ("+
+		parameterAt(self.dbType, 1)+", "+parameterAt(self.dbType, 2)+", "+parameterAt(self.dbType, 3)+", "+
+		parameterAt(self.dbType, 4)+", "+parameterAt(self.dbType, 5)+")",
+		job_id, owner, fire_at, now, expires_at)
+	if nil == e {
+		return true, owner, nil
+	}
+
+	// the lease is exists, or it is inserted by the other while it is missing.
+	var holder string
+	if qe := self.db.QueryRow("SELECT owner FROM "+*locks_table+" WHERE job_id = "+parameterAt(self.dbType, 1), job_id).Scan(&holder); nil != qe {
+		if sql.ErrNoRows == qe {
+			return false, "", i18n(self.dbType, self.drv, e)
+		}
+		return false, "", i18n(self.dbType, self.drv, qe)
+	}
+	return false, holder, nil
+}
+
+// renewLock extends the lease of the job to expires_at, it returns false if
+// the lease isn't held by owner any more. The lease is released if expires_at
+// is now.
+func (self *dbBackend) renewLock(job_id int64, owner string, expires_at time.Time) (bool, error) {
+	res, e := self.db.Exec("UPDATE "+*locks_table+" SET expires_at = "+parameterAt(self.dbType, 1)+
+		" WHERE job_id = "+parameterAt(self.dbType, 2)+" AND owner = "+parameterAt(self.dbType, 3),
+		expires_at, job_id, owner)
+	if nil != e {
+		return false, i18n(self.dbType, self.drv, e)
+	}
+	affected, e := res.RowsAffected()
+	if nil != e {
+		return false, i18n(self.dbType, self.drv, e)
+	}
+	return 0 != affected, nil
+}
+
+func (self *dbBackend) countRuns(params map[string]interface{}) (int64, error) {
+	query, arguments, e := buildSQL(self.dbType, params)
+	if nil != e {
+		return 0, e
+	}
+
+	count := int64(0)
+	e = self.db.QueryRow("SELECT count(*) FROM "+*runs_table+query, arguments...).Scan(&count)
+	if nil != e {
+		if sql.ErrNoRows == e {
+			return 0, nil
+		}
+		return 0, i18n(self.dbType, self.drv, e)
+	}
+	return count, nil
+}
+
+func (self *dbBackend) runs(params map[string]interface{}) ([]*jobRun, error) {
+	query, arguments, e := buildSQL(self.dbType, params)
+	if nil != e {
+		return nil, i18n(self.dbType, self.drv, e)
+	}
+
+	rows, e := self.db.Query("SELECT id, job_id, job_name, attempt, begin_at, end_at, status, exit_code, is_timeout, log_excerpt, log_file, stderr_tail FROM "+*runs_table+query, arguments...)
+	if nil != e {
+		if sql.ErrNoRows == e {
+			return nil, nil
+		}
+		return nil, i18n(self.dbType, self.drv, e)
+	}
+	defer rows.Close()
+
+	var results []*jobRun
+	for rows.Next() {
+		run := new(jobRun)
+		var job_id sql.NullInt64
+		var attempt sql.NullInt64
+		var begin_at NullTime
+		var end_at NullTime
+		var status sql.NullString
+		var exit_code sql.NullInt64
+		var is_timeout sql.NullBool
+		var log_excerpt sql.NullString
+		var log_file sql.NullString
+		var stderr_tail sql.NullString
+
+		e = rows.Scan(
+			&run.id,
+			&job_id,
+			&run.job_name,
+			&attempt,
+			&begin_at,
+			&end_at,
+			&status,
+			&exit_code,
+			&is_timeout,
+			&log_excerpt,
+			&log_file,
+			&stderr_tail)
+		if nil != e {
+			return nil, i18n(self.dbType, self.drv, e)
+		}
+
+		if job_id.Valid {
+			run.job_id = job_id.Int64
+		}
+		if attempt.Valid {
+			run.attempt = int(attempt.Int64)
+		}
+		if begin_at.Valid {
+			run.begin_at = begin_at.Time
+		}
+		if end_at.Valid {
+			run.end_at = end_at.Time
+		}
+		if status.Valid {
+			run.status = status.String
+		}
+		if exit_code.Valid {
+			run.ExitCode = int(exit_code.Int64)
+		}
+		if is_timeout.Valid {
+			run.IsTimeout = is_timeout.Bool
+		}
+		if log_excerpt.Valid {
+			run.log_excerpt = log_excerpt.String
+		}
+		if log_file.Valid {
+			run.log_file = log_file.String
+		}
+		if stderr_tail.Valid {
+			run.stderr_tail = stderr_tail.String
+		}
+
+		results = append(results, run)
+	}
+
+	e = rows.Err()
+	if nil != e {
+		return nil, i18n(self.dbType, self.drv, e)
+	}
+	return results, nil
+}
+
 func SplitLines(bs string) []string {
 	res := make([]string, 0, 10)
 	line_scanner := bufio.NewScanner(bytes.NewReader([]byte(bs)))
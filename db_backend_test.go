@@ -1,6 +1,7 @@
 package main
 
 import (
+	"database/sql"
 	"reflect"
 	"testing"
 	"time"
@@ -37,11 +38,21 @@ func backendTest(t *testing.T, cb func(backend *dbBackend)) {
 	  updated_at          timestamp,
 
 	  CONSTRAINT ` + *table_name + `_name_uq unique(name)
-	);`)
+	);
+
+	DROP TABLE IF EXISTS ` + *runs_table + `;
+
+	DROP TABLE IF EXISTS ` + *locks_table + `;`)
 	if nil != e {
 		t.Error(e)
 		return
 	}
+	// the table of jobs is the original schema, the new columns are added
+	// by migrate.
+	if e = backend.migrate(); nil != e {
+		t.Error(e)
+		return
+	}
 	cb(backend)
 }
 
@@ -117,3 +128,350 @@ abc`, `e1={{.a2}}`, time.Now(), time.Now())
 		}
 	})
 }
+
+func TestRuns(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		now := time.Now()
+		for _, run := range []*jobRun{{job_id: 1, job_name: "abc", begin_at: now, end_at: now.Add(time.Second), status: RUN_OK, RunResult: RunResult{ExitCode: 0}, log_excerpt: "ok", log_file: "job_abc/20060102_150405.000000.log"},
+			{job_id: 1, job_name: "abc", attempt: 1, begin_at: now, end_at: now.Add(2 * time.Second), status: RUN_TIMEOUT, RunResult: RunResult{ExitCode: -1, IsTimeout: true}},
+			{job_name: "abc.json", begin_at: now, end_at: now.Add(time.Second), status: RUN_FAILED, RunResult: RunResult{ExitCode: 2}, stderr_tail: "error"}} {
+			if e := backend.saveRun(run); nil != e {
+				t.Error(e)
+				return
+			}
+		}
+
+		count, e := backend.countRuns(map[string]interface{}{"@job_id": 1})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 2 != count {
+			t.Error("count of runs is error, ", count)
+		}
+
+		runs, e := backend.runs(map[string]interface{}{"@job_id": 1, "order_by": "id"})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 2 != len(runs) {
+			t.Error("len of runs is error, ", len(runs))
+			return
+		}
+		if RUN_OK != runs[0].status || "ok" != runs[0].log_excerpt || "job_abc/20060102_150405.000000.log" != runs[0].log_file {
+			t.Error("run is error, ", runs[0].status, runs[0].log_excerpt, runs[0].log_file)
+		}
+		if RUN_TIMEOUT != runs[1].status || !runs[1].IsTimeout || 1 != runs[1].attempt {
+			t.Error("run is error, ", runs[1].status, runs[1].IsTimeout, runs[1].attempt)
+		}
+
+		runs, e = backend.runs(map[string]interface{}{"@job_name": "abc.json"})
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 1 != len(runs) || 0 != runs[0].job_id || 2 != runs[0].ExitCode || "error" != runs[0].stderr_tail {
+			t.Error("run of file job is error, ", runs)
+		}
+	})
+}
+
+func TestCreateRunsTable(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		run := &jobRun{job_name: "abc", begin_at: time.Now(), end_at: time.Now(), status: RUN_OK}
+		if e := backend.saveRun(run); nil != e {
+			t.Error(e)
+			return
+		}
+
+		// the table is created only if it is missing.
+		if e := backend.createRunsTable(); nil != e {
+			t.Error(e)
+			return
+		}
+		count, e := backend.countRuns(nil)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 1 != count {
+			t.Error("the runs are lost, ", count)
+		}
+	})
+}
+
+func TestMigrate(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		if e := backend.migrate(); nil != e {
+			t.Error("migrate is not idempotent, ", e)
+			return
+		}
+
+		_, e := backend.db.Exec(`INSERT INTO `+*table_name+`( name, expression, execute, created_at, updated_at)
+    VALUES ('abc', '0 0 * * * ?', 'abcd', $1, $2);`, time.Now(), time.Now())
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		jobs, e := backend.where(nil)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 1 != len(jobs) || CONCURRENCY_FORBID != jobs[0].concurrency || defaultRetryBackoff != jobs[0].retry_backoff || nil != jobs[0].log_options {
+			t.Error("the job of the original schema is error, ", jobs)
+		}
+	})
+}
+
+func TestInsertUpdateDelete(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		job := &JobFromDB{}
+		job.name = "abc"
+		job.expression = "0 0 * * * ?"
+		job.execute = "abcd"
+		job.arguments = []string{"-a=b1", "-cp", "abc"}
+		job.environments = []string{"e1=b2"}
+		job.timeout = 5 * time.Minute
+		job.max_retries = 3
+		job.retry_delay = 30 * time.Second
+		job.retry_backoff = 1.5
+		job.concurrency = CONCURRENCY_QUEUE
+		job.concurrency_limit = 2
+		job.priority = 7
+		job.notify_to = []string{"a@example.com", "b@example.com"}
+		job.webhooks = []string{"http://127.0.0.1/a", "http://127.0.0.1/b"}
+		job.depends_on = []string{"a.json"}
+		job.on_success = []string{"b.json", "12"}
+		job.on_failure = []string{"c.json"}
+		job.log_options = map[string]interface{}{"per_run_log": true, "log_max_bytes": 1024, "output": OUTPUT_SEPARATE}
+
+		id, e := backend.insert(job)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+
+		found, e := backend.find(id)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if "abc" != found.name || "abcd" != found.execute || 5*time.Minute != found.timeout {
+			t.Error("job is error, ", found.name, found.execute, found.timeout)
+		}
+		if 3 != found.max_retries || 30*time.Second != found.retry_delay || 1.5 != found.retry_backoff {
+			t.Error("retry policy is error, ", found.max_retries, found.retry_delay, found.retry_backoff)
+		}
+		if CONCURRENCY_QUEUE != found.concurrency || 2 != found.concurrency_limit || 7 != found.priority {
+			t.Error("concurrency is error, ", found.concurrency, found.concurrency_limit, found.priority)
+		}
+		if !reflect.DeepEqual(job.notify_to, found.notify_to) {
+			t.Error(found.notify_to)
+		}
+		if !reflect.DeepEqual(job.webhooks, found.webhooks) {
+			t.Error(found.webhooks)
+		}
+		if !reflect.DeepEqual(job.depends_on, found.depends_on) ||
+			!reflect.DeepEqual(job.on_success, found.on_success) ||
+			!reflect.DeepEqual(job.on_failure, found.on_failure) {
+			t.Error("dependencies is error, ", found.depends_on, found.on_success, found.on_failure)
+		}
+		if e = afterLoad(found, map[string]interface{}{"log_max_num": 3, "output": OUTPUT_TAGGED}); nil != e {
+			t.Error(e)
+			return
+		}
+		if !found.per_run_log || 1024 != found.log_max_bytes || 3 != found.log_max_num || OUTPUT_SEPARATE != found.output {
+			t.Error("log options is error, ", found.per_run_log, found.log_max_bytes, found.log_max_num, found.output)
+		}
+		if !reflect.DeepEqual(job.arguments, found.arguments) {
+			t.Error(found.arguments)
+		}
+		if !reflect.DeepEqual(job.environments, found.environments) {
+			t.Error(found.environments)
+		}
+
+		old_updated_at := found.updated_at
+		time.Sleep(10 * time.Millisecond)
+		found.expression = "0 30 * * * ?"
+		if e = backend.update(found); nil != e {
+			t.Error(e)
+			return
+		}
+
+		found, e = backend.find(id)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if "0 30 * * * ?" != found.expression {
+			t.Error("expression is error ", found.expression)
+		}
+		if !found.updated_at.After(old_updated_at) {
+			t.Error("updated_at is not changed, ", found.updated_at, old_updated_at)
+		}
+
+		if e = backend.delete(id); nil != e {
+			t.Error(e)
+			return
+		}
+		if e = backend.delete(id); sql.ErrNoRows != e {
+			t.Error("delete a deleted job should return ErrNoRows, ", e)
+		}
+		count, e := backend.count(nil)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if 0 != count {
+			t.Error("count of jobs is error, ", count)
+		}
+	})
+}
+
+func TestLock(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		if e := backend.createLocksTable(); nil != e {
+			t.Error(e)
+			return
+		}
+
+		fire_at := time.Now().Truncate(time.Second)
+		now := fire_at.Add(10 * time.Millisecond)
+		ok, owner, e := backend.acquireLock(1, "a", fire_at, now, now.Add(time.Minute))
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if !ok || "a" != owner {
+			t.Error("acquire the lease failed, ", ok, owner)
+		}
+
+		// the run is taken by a, even if the clock of b is a bit different.
+		if ok, owner, e = backend.acquireLock(1, "b", fire_at, now.Add(time.Second), now.Add(time.Minute)); nil != e || ok || "a" != owner {
+			t.Error("the run is taken by a, ", ok, owner, e)
+		}
+		if ok, e = backend.renewLock(1, "a", now.Add(time.Second)); nil != e || !ok {
+			t.Error("release the lease failed, ", ok, e)
+		}
+		if ok, _, e = backend.acquireLock(1, "b", fire_at, now.Add(2*time.Second), now.Add(time.Minute)); nil != e || ok {
+			t.Error("the run is taken by a after it is released, ", ok, e)
+		}
+
+		// the job is running by a, the next run is taken after it is expired.
+		if ok, _, e = backend.acquireLock(1, "a", fire_at.Add(time.Minute), now.Add(time.Minute), now.Add(2*time.Minute)); nil != e || !ok {
+			t.Error("acquire the next run failed, ", ok, e)
+		}
+		if ok, owner, e = backend.acquireLock(1, "b", fire_at.Add(2*time.Minute), now.Add(2*time.Minute-time.Second), now.Add(3*time.Minute)); nil != e || ok || "a" != owner {
+			t.Error("the lease is held by a, ", ok, owner, e)
+		}
+		if ok, owner, e = backend.acquireLock(1, "b", fire_at.Add(2*time.Minute), now.Add(2*time.Minute), now.Add(3*time.Minute)); nil != e || !ok || "b" != owner {
+			t.Error("take over the expired lease failed, ", ok, owner, e)
+		}
+		if ok, e = backend.renewLock(1, "a", now.Add(3*time.Minute)); nil != e || ok {
+			t.Error("the lease is lost by a, ", ok, e)
+		}
+
+		// the lease is inserted by the other while it is missing.
+		is_test_for_lock = true
+		defer func() { is_test_for_lock = false }()
+
+		type result struct {
+			ok    bool
+			owner string
+			e     error
+		}
+		ch := make(chan result, 1)
+		go func() {
+			ok, owner, e := backend.acquireLock(2, "a", fire_at, now, now.Add(time.Minute))
+			ch <- result{ok, owner, e}
+		}()
+
+		if _, e = backend.db.Exec("INSERT INTO "+*locks_table+"(job_id, owner, fire_at, locked_at, expires_at) VALUES ($1, $2, $3, $4, $5)",
+			2, "b", fire_at, now, now.Add(time.Minute)); nil != e {
+			t.Error(e)
+		}
+		test_ch_for_lock <- 1
+
+		if r := <-ch; nil != r.e || r.ok || "b" != r.owner {
+			t.Error("the lease is held by b, ", r.ok, r.owner, r.e)
+		}
+	})
+}
+
+func TestLockOfEvery(t *testing.T) {
+	backendTest(t, func(backend *dbBackend) {
+		if e := backend.createLocksTable(); nil != e {
+			t.Error(e)
+			return
+		}
+
+		job := &JobFromDB{}
+		job.id = 1
+		job.expression = "@every 1m"
+
+		// a and b run the job every minute, but b is started 59 seconds later
+		// than a, the job is run by a only.
+		started_at := time.Now().Truncate(time.Minute)
+		for i := 0; i < 5; i++ {
+			a_at := started_at.Add(time.Duration(i) * time.Minute).Add(500 * time.Millisecond)
+			b_at := a_at.Add(59 * time.Second)
+			if ok, _, e := backend.acquireLock(job.id, "a", job.fireTime(a_at), a_at, a_at.Add(time.Minute)); nil != e || !ok {
+				t.Error(i, "a acquire the lease failed, ", ok, e)
+				return
+			}
+			finished_at := a_at.Add(time.Second)
+			if ok, e := backend.renewLock(job.id, "a", job.releaseTime(a_at, finished_at)); nil != e || !ok {
+				t.Error(i, "a release the lease failed, ", ok, e)
+				return
+			}
+			if ok, owner, e := backend.acquireLock(job.id, "b", job.fireTime(b_at), b_at, b_at.Add(time.Minute)); nil != e || ok || "a" != owner {
+				t.Error(i, "the job is run by a and b, ", ok, owner, e)
+				return
+			}
+
+			// b is started in the next interval but a bit earlier than a.
+			b_at = a_at.Add(time.Minute - 10*time.Millisecond)
+			if ok, owner, e := backend.acquireLock(job.id, "b", job.fireTime(b_at), b_at, b_at.Add(time.Minute)); nil != e || ok || "a" != owner {
+				t.Error(i, "the job is run by a and b, ", ok, owner, e)
+				return
+			}
+		}
+
+		// a is stopped, the job is run by b after the lease is released.
+		b_at := started_at.Add(6 * time.Minute).Add(time.Second)
+		if ok, owner, e := backend.acquireLock(job.id, "b", job.fireTime(b_at), b_at, b_at.Add(time.Minute)); nil != e || !ok || "b" != owner {
+			t.Error("b take over the lease failed, ", ok, owner, e)
+		}
+	})
+}
+
+func TestFireTime(t *testing.T) {
+	job := &JobFromDB{}
+	job.expression = "0 */5 * * * ?"
+	fire_at := time.Date(2020, 1, 1, 2, 5, 0, 0, time.Local)
+	for _, test := range []struct {
+		now      time.Time
+		excepted time.Time
+	}{{now: fire_at, excepted: fire_at},
+		{now: fire_at.Add(300 * time.Millisecond), excepted: fire_at},
+		{now: fire_at.Add(time.Minute), excepted: fire_at.Add(time.Minute)}} {
+		if at := job.fireTime(test.now); !test.excepted.Equal(at) {
+			t.Error(test.now, "fire time is error, ", at)
+		}
+	}
+
+	// the daemons are started at the different time, the runs in the same
+	// interval get the same time.
+	job.expression = "@every 5m"
+	if at, other := job.fireTime(fire_at.Add(10*time.Second)), job.fireTime(fire_at.Add(4*time.Minute)); !at.Equal(other) || at.After(fire_at.Add(10*time.Second)) {
+		t.Error("fire time of @every is error, ", at, other)
+	}
+
+	job.expression = ""
+	job.depends_on = []string{"a.json"}
+	if now := fire_at.Add(time.Second); !now.Equal(job.fireTime(now)) {
+		t.Error("the run without expression isn't fired by the cron")
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/runner-mei/cron"
+)
+
+// jobs_cron is the scheduler of all the jobs, the downstream jobs are found
+// in it after a job is finished.
+var jobs_cron *cron.Cron
+
+// triggeredSchedule is the schedule of the job that hasn't a expression, it
+// is never activated by the cron, the job is only run by its upstream jobs.
+type triggeredSchedule struct{}
+
+func (triggeredSchedule) Next(t time.Time) time.Time {
+	return time.Time{}
+}
+
+// scheduleOf returns the schedule of the job by the expression of it.
+func scheduleOf(job *ShellJob) (cron.Schedule, error) {
+	if "" == job.expression {
+		return triggeredSchedule{}, nil
+	}
+	return Parse(job.expression)
+}
+
+// entryId returns the id of the job in the cron, it is the name for the job
+// file and the id for the job of the db.
+func (self *ShellJob) entryId() string {
+	if 0 != self.id {
+		return fmt.Sprint(self.id)
+	}
+	return self.name
+}
+
+// isReferred returns true if ref is the id or the name of the job.
+func (self *ShellJob) isReferred(ref string) bool {
+	return ref == self.entryId() || ref == self.name
+}
+
+func scheduledJobs(cr *cron.Cron) map[string]*ShellJob {
+	jobs := map[string]*ShellJob{}
+	if nil == cr {
+		return jobs
+	}
+	for _, ent := range cr.Entries() {
+		if job, _ := toShellJob(ent.Job); nil != job {
+			jobs[ent.Id] = job
+		}
+	}
+	return jobs
+}
+
+// resolveJob returns the id of the job that is referred by ref.
+func resolveJob(jobs map[string]*ShellJob, ref string) (string, bool) {
+	if _, ok := jobs[ref]; ok {
+		return ref, true
+	}
+	for id, job := range jobs {
+		if job.isReferred(ref) {
+			return id, true
+		}
+	}
+	return "", false
+}
+
+func sortedIds(jobs map[string]*ShellJob) []string {
+	ids := make([]string, 0, len(jobs))
+	for id := range jobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// downstreamJobs returns the ids of the jobs that are triggered while the job
+// is finished with the status:
+//
+//	depends_on - the job runs after all the jobs in it are succeeded.
+//	on_success - the jobs in it run after the job is succeeded.
+//	on_failure - the jobs in it run after the job is failed or timeout.
+//
+// all the downstream jobs are returned if status is empty.
+func downstreamJobs(jobs map[string]*ShellJob, job *ShellJob, status string) []string {
+	var refs []string
+	if "" == status || RUN_OK == status {
+		refs = append(refs, job.on_success...)
+	}
+	if "" == status || RUN_FAILED == status || RUN_TIMEOUT == status {
+		refs = append(refs, job.on_failure...)
+	}
+
+	var ids []string
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		if id, ok := resolveJob(jobs, ref); ok && !seen[id] {
+			seen[id] = true
+			ids = append(ids, id)
+		}
+	}
+
+	if "" != status && RUN_OK != status {
+		return ids
+	}
+	for _, id := range sortedIds(jobs) {
+		if seen[id] {
+			continue
+		}
+		for _, ref := range jobs[id].depends_on {
+			if job.isReferred(ref) {
+				seen[id] = true
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// upstreamJobs returns the ids of the jobs that trigger the job.
+func upstreamJobs(jobs map[string]*ShellJob, id string) []string {
+	var ids []string
+	for _, other := range sortedIds(jobs) {
+		for _, downstream := range downstreamJobs(jobs, jobs[other], "") {
+			if id == downstream {
+				ids = append(ids, other)
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// findCycle returns the path of a dependency cycle that includes the job of
+// id, or nil if there isn't any cycle.
+func findCycle(jobs map[string]*ShellJob, id string) []string {
+	visited := map[string]bool{}
+	var path []string
+	var visit func(current string) bool
+	visit = func(current string) bool {
+		path = append(path, current)
+		for _, next := range downstreamJobs(jobs, jobs[current], "") {
+			if next == id {
+				path = append(path, next)
+				return true
+			}
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			if visit(next) {
+				return true
+			}
+		}
+		path = path[:len(path)-1]
+		return false
+	}
+	if _, ok := jobs[id]; !ok || !visit(id) {
+		return nil
+	}
+	return path
+}
+
+// checkCycle returns a error if the job of id makes a dependency cycle while
+// it is scheduled.
+func checkCycle(cr *cron.Cron, id string, job *ShellJob) error {
+	jobs := scheduledJobs(cr)
+	jobs[id] = job
+	if path := findCycle(jobs, id); nil != path {
+		return errors.New("[" + job.name + "] dependency cycle is found, " + strings.Join(path, " -> "))
+	}
+	return nil
+}
+
+// isListed returns true if the job of id is referred in refs.
+func isListed(jobs map[string]*ShellJob, refs []string, id string) bool {
+	for _, ref := range refs {
+		if resolved, ok := resolveJob(jobs, ref); ok && id == resolved {
+			return true
+		}
+	}
+	return false
+}
+
+// dependencyReady records the success of the upstream job, it returns true
+// if all the jobs in depends_on are succeeded since the job is triggered last
+// time, and the records are cleared for the next cycle. The jobs that aren't
+// scheduled any more are ignored.
+func (self *ShellJob) dependencyReady(jobs map[string]*ShellJob, upstream *ShellJob) bool {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+
+	if nil == self.upstreams_succeeded {
+		self.upstreams_succeeded = map[string]bool{}
+	}
+	for _, ref := range self.depends_on {
+		if upstream.isReferred(ref) {
+			self.upstreams_succeeded[ref] = true
+		}
+	}
+	for _, ref := range self.depends_on {
+		if _, ok := resolveJob(jobs, ref); ok && !self.upstreams_succeeded[ref] {
+			return false
+		}
+	}
+	self.upstreams_succeeded = nil
+	return true
+}
+
+// triggerDownstream runs the jobs that depend on the result of the run.
+func (self *ShellJob) triggerDownstream(run *jobRun) {
+	if nil == jobs_cron {
+		return
+	}
+	jobs := scheduledJobs(jobs_cron)
+	ids := downstreamJobs(jobs, self, run.status)
+	if 0 == len(ids) {
+		return
+	}
+	if isStopping() {
+		log.Println("[" + self.name + "] run " + run.status + ", the daemon is stopping, don't trigger '" + strings.Join(ids, "', '") + "'.")
+		return
+	}
+
+	ready := map[string]bool{}
+	for _, id := range ids {
+		if !isListed(jobs, self.on_success, id) && !isListed(jobs, self.on_failure, id) &&
+			!jobs[id].dependencyReady(jobs, self) {
+			log.Println("[" + self.name + "] run " + run.status + ", '" + id + "' is waiting for the other jobs in depends_on.")
+			continue
+		}
+		ready[id] = true
+	}
+	for _, ent := range jobs_cron.Entries() {
+		if ready[ent.Id] {
+			log.Println("[" + self.name + "] run " + run.status + ", trigger '" + ent.Id + "'.")
+			ent.Job.Run()
+		}
+	}
+}
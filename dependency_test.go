@@ -0,0 +1,205 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/cron"
+)
+
+func TestDownstreamJobs(t *testing.T) {
+	a := &ShellJob{name: "a.json", on_success: []string{"b.json"}, on_failure: []string{"c.json"}}
+	b := &ShellJob{name: "b.json"}
+	c := &ShellJob{name: "c.json"}
+	d := &ShellJob{id: 4, name: "d", depends_on: []string{"a.json"}}
+	jobs := map[string]*ShellJob{"a.json": a, "b.json": b, "c.json": c, "4": d}
+
+	for _, test := range []struct {
+		status   string
+		excepted []string
+	}{{status: RUN_OK, excepted: []string{"b.json", "4"}},
+		{status: RUN_FAILED, excepted: []string{"c.json"}},
+		{status: RUN_TIMEOUT, excepted: []string{"c.json"}},
+		{status: RUN_KILLED},
+		{status: "", excepted: []string{"b.json", "c.json", "4"}}} {
+		if ids := downstreamJobs(jobs, a, test.status); !reflect.DeepEqual(test.excepted, ids) {
+			t.Error(test.status, "downstream is error, ", ids)
+		}
+	}
+	if ids := upstreamJobs(jobs, "4"); !reflect.DeepEqual([]string{"a.json"}, ids) {
+		t.Error("upstream is error, ", ids)
+	}
+
+	if path := findCycle(jobs, "a.json"); nil != path {
+		t.Error("cycle is error, ", path)
+	}
+	c.on_success = []string{"d"}
+	d.on_failure = []string{"c.json"}
+	if path := findCycle(jobs, "a.json"); nil != path {
+		t.Error("cycle is error, ", path)
+	}
+	d.on_failure = []string{"a.json"}
+	if path := findCycle(jobs, "a.json"); !reflect.DeepEqual([]string{"a.json", "c.json", "4", "a.json"}, path) {
+		t.Error("cycle is error, ", path)
+	}
+}
+
+func TestCheckCycle(t *testing.T) {
+	cr := cron.New()
+	sch, _ := Parse("@every 1h")
+	cr.Schedule("a.json", sch, &ShellJob{name: "a.json", on_success: []string{"b.json"}})
+
+	if e := checkCycle(cr, "b.json", &ShellJob{name: "b.json", on_success: []string{"c.json"}}); nil != e {
+		t.Error(e)
+	}
+	e := checkCycle(cr, "b.json", &ShellJob{name: "b.json", depends_on: []string{"a.json"}, on_failure: []string{"a.json"}})
+	if nil == e || !strings.Contains(e.Error(), "b.json -> a.json -> b.json") {
+		t.Error("cycle isn't found, ", e)
+	}
+}
+
+func TestTriggerDownstream(t *testing.T) {
+	shellJobTest(t, func(dir string, job *ShellJob) {
+		job.name = "a.json"
+		job.arguments = []string{"-c", "exit 0"}
+
+		b := &ShellJob{name: "b.json",
+			execute:    job.execute,
+			arguments:  []string{"-c", "echo b"},
+			timeout:    job.timeout,
+			logfile:    filepath.Join(dir, "job_b.log"),
+			depends_on: []string{"a.json"}}
+		c := &ShellJob{name: "c.json",
+			execute:   job.execute,
+			arguments: []string{"-c", "echo c"},
+			timeout:   job.timeout,
+			logfile:   filepath.Join(dir, "job_c.log")}
+		job.on_failure = []string{"c.json"}
+
+		cr := cron.New()
+		sch, _ := Parse("@every 1h")
+		cr.Schedule("a.json", sch, job)
+		cr.Schedule("b.json", sch, b)
+		cr.Schedule("c.json", sch, c)
+		jobs_cron = cr
+		defer func() {
+			jobs_cron = nil
+		}()
+
+		job.runWithRetries(newRunInstance())
+		time.Sleep(50 * time.Millisecond)
+		waitJob(t, b, 5*time.Second)
+		if !fileExists(b.logfile) || fileExists(c.logfile) {
+			t.Error("the downstream of success is error")
+		}
+
+		job.arguments = []string{"-c", "exit 1"}
+		job.runWithRetries(newRunInstance())
+		time.Sleep(50 * time.Millisecond)
+		waitJob(t, c, 5*time.Second)
+		bs, _ := ioutil.ReadFile(b.logfile)
+		if 1 != strings.Count(string(bs), "= begin at ") || !fileExists(c.logfile) {
+			t.Error("the downstream of failure is error")
+		}
+
+		// the downstream isn't triggered while the daemon is stopping.
+		is_stopping = 1
+		defer func() {
+			is_stopping = 0
+		}()
+		job.arguments = []string{"-c", "exit 0"}
+		job.runWithRetries(newRunInstance())
+		time.Sleep(50 * time.Millisecond)
+		waitJob(t, b, 5*time.Second)
+		bs, _ = ioutil.ReadFile(b.logfile)
+		if 1 != strings.Count(string(bs), "= begin at ") {
+			t.Error("the downstream is triggered while the daemon is stopping")
+		}
+	})
+}
+
+func TestDependsOnAll(t *testing.T) {
+	shellJobTest(t, func(dir string, job *ShellJob) {
+		job.name = "a.json"
+		job.arguments = []string{"-c", "exit 0"}
+
+		b := &ShellJob{name: "b.json",
+			execute:   job.execute,
+			arguments: []string{"-c", "exit 0"},
+			timeout:   job.timeout,
+			logfile:   filepath.Join(dir, "job_b.log")}
+		c := &ShellJob{name: "c.json",
+			execute:    job.execute,
+			arguments:  []string{"-c", "echo c"},
+			timeout:    job.timeout,
+			logfile:    filepath.Join(dir, "job_c.log"),
+			depends_on: []string{"a.json", "b.json"}}
+
+		cr := cron.New()
+		sch, _ := Parse("@every 1h")
+		cr.Schedule("a.json", sch, job)
+		cr.Schedule("b.json", sch, b)
+		cr.Schedule("c.json", triggeredSchedule{}, c)
+		jobs_cron = cr
+		defer func() {
+			jobs_cron = nil
+		}()
+
+		runs := func() int {
+			time.Sleep(50 * time.Millisecond)
+			waitJob(t, c, 5*time.Second)
+			bs, _ := ioutil.ReadFile(c.logfile)
+			return strings.Count(string(bs), "= begin at ")
+		}
+
+		// c runs after both a and b are succeeded.
+		job.runWithRetries(newRunInstance())
+		job.runWithRetries(newRunInstance())
+		if n := runs(); 0 != n {
+			t.Error("c runs before b is succeeded, ", n)
+		}
+		b.runWithRetries(newRunInstance())
+		if n := runs(); 1 != n {
+			t.Error("c doesn't run after a and b are succeeded, ", n)
+		}
+
+		// the successes are cleared after c is triggered, a failure of b
+		// isn't counted.
+		job.runWithRetries(newRunInstance())
+		b.arguments = []string{"-c", "exit 1"}
+		b.runWithRetries(newRunInstance())
+		if n := runs(); 1 != n {
+			t.Error("c runs before b is succeeded in the next cycle, ", n)
+		}
+		b.arguments = []string{"-c", "exit 0"}
+		b.runWithRetries(newRunInstance())
+		if n := runs(); 2 != n {
+			t.Error("c doesn't run in the next cycle, ", n)
+		}
+	})
+}
+
+func TestJobWithoutExpression(t *testing.T) {
+	job, e := loadJobFromMap("b.json", []map[string]interface{}{{"execute": "/bin/sh", "depends_on": "a.json"}})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	sch, e := scheduleOf(job)
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if next := sch.Next(time.Now()); !next.IsZero() {
+		t.Error("the job without expression is scheduled, ", next)
+	}
+
+	_, e = loadJobFromMap("c.json", []map[string]interface{}{{"execute": "/bin/sh"}})
+	if nil == e || !strings.Contains(e.Error(), "'expression' is missing") {
+		t.Error("the expression is required without depends_on, ", e)
+	}
+}
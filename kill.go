@@ -1,19 +1,19 @@
 package main
 
 import (
-	"os"
-	"runtime"
+	"flag"
+	"time"
 )
 
+var kill_grace = flag.Duration("kill_grace", 0, "the grace period between the terminate signal and the kill signal, it is 5s if it is 0")
+
+// killByPid kills the process tree of pid, the processes are terminated
+// first(SIGTERM on posix, CTRL_BREAK on windows), and then are killed after
+// kill_grace.
 func killByPid(pid int) error {
-	if "windows" == runtime.GOOS {
-		return killProcess(pid)
-	} else {
-		pr, e := os.FindProcess(pid)
-		if nil != e {
-			return e
-		}
-		defer pr.Release()
-		return pr.Kill()
+	grace := *kill_grace
+	if 0 >= grace {
+		grace = 5 * time.Second
 	}
+	return killProcessTree(pid, grace)
 }
@@ -0,0 +1,54 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// prepareProcess starts the process in its own process group, so that the
+// children of it are killed with it.
+func prepareProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+func attachProcess(cmd *exec.Cmd) error {
+	return nil
+}
+
+func detachProcess(pid int) {
+}
+
+func killProcess(pid int) error {
+	return syscall.Kill(pid, syscall.SIGKILL)
+}
+
+func isGroupAlive(pgid int) bool {
+	return syscall.ESRCH != syscall.Kill(-pgid, 0)
+}
+
+func killProcessTree(pid int, grace time.Duration) error {
+	e := syscall.Kill(-pid, syscall.SIGTERM)
+	if nil != e {
+		if syscall.ESRCH == e {
+			return nil
+		}
+		// it isn't a process group.
+		return killProcess(pid)
+	}
+
+	for deadline := time.Now().Add(grace); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if !isGroupAlive(pid) {
+			return nil
+		}
+	}
+
+	e = syscall.Kill(-pid, syscall.SIGKILL)
+	if nil != e && syscall.ESRCH != e {
+		return e
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestKillProcessTree(t *testing.T) {
+	for _, test := range []struct {
+		script string
+		grace  time.Duration
+	}{{script: "sleep 100 & sleep 100", grace: 10 * time.Second},
+		{script: "trap '' TERM; sleep 100 & sleep 100", grace: 200 * time.Millisecond}} {
+
+		cmd := exec.Command("/bin/sh", "-c", test.script)
+		prepareProcess(cmd)
+		if e := cmd.Start(); nil != e {
+			t.Error(e)
+			return
+		}
+		c := make(chan error, 1)
+		go func() {
+			c <- cmd.Wait()
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		started_at := time.Now()
+		if e := killProcessTree(cmd.Process.Pid, test.grace); nil != e {
+			t.Error(e)
+		}
+		if time.Now().Sub(started_at) > 5*time.Second {
+			t.Error(test.script, "kill is timeout, ", time.Now().Sub(started_at))
+		}
+
+		select {
+		case <-c:
+		case <-time.After(5 * time.Second):
+			t.Error(test.script, "wait is timeout")
+		}
+		for started_at := time.Now(); isGroupAlive(cmd.Process.Pid); time.Sleep(10 * time.Millisecond) {
+			if time.Now().Sub(started_at) > 2*time.Second {
+				t.Error(test.script, "the children is alive.")
+				break
+			}
+		}
+	}
+}
@@ -1,12 +1,95 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"os"
+	"os/exec"
+	"sync"
 	"syscall"
+	"time"
 )
 
+const (
+	PROCESS_TERMINATE      = 0x0001
+	PROCESS_SET_QUOTA      = 0x0100
+	PROCESS_SUSPEND_RESUME = 0x0800
+	CREATE_SUSPENDED       = 0x00000004
+	DETACHED_PROCESS       = 0x00000008
+	CTRL_BREAK_EVENT       = 1
+	WAIT_OBJECT_0          = 0
+)
+
+var (
+	kernel32                     = syscall.NewLazyDLL("kernel32.dll")
+	procCreateJobObjectW         = kernel32.NewProc("CreateJobObjectW")
+	procAssignProcessToJobObject = kernel32.NewProc("AssignProcessToJobObject")
+	procTerminateJobObject       = kernel32.NewProc("TerminateJobObject")
+	procGenerateConsoleCtrlEvent = kernel32.NewProc("GenerateConsoleCtrlEvent")
+	ntdll                        = syscall.NewLazyDLL("ntdll.dll")
+	procNtResumeProcess          = ntdll.NewProc("NtResumeProcess")
+
+	job_objects_lock sync.Mutex
+	job_objects      = map[int]syscall.Handle{}
+)
+
+// prepareProcess starts the process suspended in a new process group, so
+// that the CTRL_BREAK is only sent to it, and it can't start any child before
+// it is assigned to the job object by attachProcess.
+func prepareProcess(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | CREATE_SUSPENDED}
+}
+
+// attachProcess assigns the process to a job object and then resumes it, the
+// children of it are in the job object too, so that they are killed with it.
+// The process is killed if it can't be resumed.
+func attachProcess(cmd *exec.Cmd) error {
+	h, e := syscall.OpenProcess(PROCESS_SET_QUOTA|PROCESS_TERMINATE|PROCESS_SUSPEND_RESUME, false, uint32(cmd.Process.Pid))
+	if nil != e {
+		cmd.Process.Kill()
+		return os.NewSyscallError("OpenProcess", e)
+	}
+	defer syscall.CloseHandle(h)
+
+	attach_error := assignProcess(cmd.Process.Pid, h)
+	if r, _, _ := procNtResumeProcess.Call(uintptr(h)); 0 != r {
+		cmd.Process.Kill()
+		return errors.New("NtResumeProcess failed, status is " + fmt.Sprintf("0x%08X", r))
+	}
+	return attach_error
+}
+
+func assignProcess(pid int, h syscall.Handle) error {
+	r, _, e := procCreateJobObjectW.Call(0, 0)
+	if 0 == r {
+		return os.NewSyscallError("CreateJobObject", e)
+	}
+	job := syscall.Handle(r)
+
+	r, _, e = procAssignProcessToJobObject.Call(uintptr(job), uintptr(h))
+	if 0 == r {
+		syscall.CloseHandle(job)
+		return os.NewSyscallError("AssignProcessToJobObject", e)
+	}
+
+	job_objects_lock.Lock()
+	job_objects[pid] = job
+	job_objects_lock.Unlock()
+	return nil
+}
+
+func detachProcess(pid int) {
+	job_objects_lock.Lock()
+	job, ok := job_objects[pid]
+	delete(job_objects, pid)
+	job_objects_lock.Unlock()
+
+	if ok {
+		syscall.CloseHandle(job)
+	}
+}
+
 func killProcess(pid int) error {
-	const PROCESS_TERMINATE = 0x0001
 	const da = syscall.STANDARD_RIGHTS_READ |
 		syscall.PROCESS_QUERY_INFORMATION | syscall.SYNCHRONIZE | PROCESS_TERMINATE
 	h, e := syscall.OpenProcess(da, false, uint32(pid))
@@ -21,3 +104,39 @@ func killProcess(pid int) error {
 	}
 	return nil
 }
+
+// waitProcess waits for the process is exited, it returns false if timeout.
+func waitProcess(pid int, timeout time.Duration) bool {
+	h, e := syscall.OpenProcess(syscall.SYNCHRONIZE, false, uint32(pid))
+	if nil != e {
+		return true
+	}
+	defer syscall.CloseHandle(h)
+
+	s, _ := syscall.WaitForSingleObject(h, uint32(timeout/time.Millisecond))
+	return WAIT_OBJECT_0 == s
+}
+
+func killProcessTree(pid int, grace time.Duration) error {
+	// the process is terminated at once if the event isn't sent(e.g. it
+	// isn't attached to a console), it is pointless to wait for it.
+	if r, _, _ := procGenerateConsoleCtrlEvent.Call(CTRL_BREAK_EVENT, uintptr(pid)); 0 != r {
+		waitProcess(pid, grace)
+	}
+
+	job_objects_lock.Lock()
+	defer job_objects_lock.Unlock()
+	job, ok := job_objects[pid]
+	if !ok {
+		if waitProcess(pid, 0) {
+			return nil
+		}
+		return killProcess(pid)
+	}
+
+	r, _, e := procTerminateJobObject.Call(uintptr(job), 1)
+	if 0 == r {
+		return os.NewSyscallError("TerminateJobObject", e)
+	}
+	return nil
+}
@@ -3,7 +3,9 @@ package main
 import (
 	"os"
 	"os/exec"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestKillProcess(t *testing.T) {
@@ -42,3 +44,24 @@ func TestKillProcess2(t *testing.T) {
 		return
 	}
 }
+
+func TestKillProcessWithoutConsole(t *testing.T) {
+	pr := exec.Command("ping", "127.0.0.1", "-t")
+	// the process isn't attached to a console, the ctrl-break isn't sent.
+	pr.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP | DETACHED_PROCESS}
+	e := pr.Start()
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	defer pr.Process.Kill()
+
+	started_at := time.Now()
+	if e = killProcessTree(pr.Process.Pid, 10*time.Second); nil != e {
+		t.Error(e)
+		return
+	}
+	if elapsed := time.Now().Sub(started_at); elapsed > 5*time.Second {
+		t.Error("the process is terminated after the grace period, ", elapsed)
+	}
+}
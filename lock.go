@@ -0,0 +1,186 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/runner-mei/cron"
+)
+
+var (
+	db_lock        = flag.Bool("db_lock", false, "acquire the lease of a db job in the db before running it, so that the job is run by only one of the daemons that share the db")
+	db_lock_expiry = flag.Duration("db_lock_expiry", 0, "the lease of a job is expired if it isn't renewed in the interval(the daemon is crashed), it is 5m if it is 0")
+	db_lock_owner  = flag.String("db_lock_owner", "", "the name of the daemon in the leases, it is <hostname>:<pid> if it is empty")
+)
+
+// fireTolerance is the max delay between the activation time of the schedule
+// and the time that the job is run by the cron, the run isn't fired by the
+// cron(it is run by hand or by the upstream jobs) if it is exceeded.
+const fireTolerance = 5 * time.Second
+
+func lockOwner() string {
+	if "" != *db_lock_owner {
+		return *db_lock_owner
+	}
+	hostname, _ := os.Hostname()
+	return hostname + ":" + fmt.Sprint(os.Getpid())
+}
+
+func lockExpiry() time.Duration {
+	if 0 < *db_lock_expiry {
+		return *db_lock_expiry
+	}
+	return 5 * time.Minute
+}
+
+// lease is the lease of a db job that is held by this daemon, it is renewed
+// while the job is running.
+type lease struct {
+	lock       sync.Mutex
+	started_at time.Time
+	renewed_at time.Time
+	stop       chan struct{}
+}
+
+// everyInterval returns the interval of the '@every' schedule, it is 0 for
+// the other schedules.
+func (self *JobFromDB) everyInterval() time.Duration {
+	sch, e := scheduleOf(&self.ShellJob)
+	if nil != e {
+		return 0
+	}
+	switch every := sch.(type) {
+	case cron.ConstantDelaySchedule:
+		return every.Delay
+	case *cron.ConstantDelaySchedule:
+		return every.Delay
+	}
+	return 0
+}
+
+// fireTime returns the activation time of the schedule that fires the run at
+// now, every daemon gets the same time for the same activation even if their
+// clocks are a bit different. The activations of '@every' depend on the time
+// that the daemon is started, so the run is keyed by the slot of the interval
+// that now is in. It is now if the run isn't fired by the cron.
+func (self *JobFromDB) fireTime(now time.Time) time.Time {
+	if interval := self.everyInterval(); 0 < interval {
+		return now.Truncate(interval)
+	}
+	sch, e := scheduleOf(&self.ShellJob)
+	if nil != e {
+		return now
+	}
+	fire_at := now
+	for next := sch.Next(now.Add(-fireTolerance)); !next.IsZero() && !next.After(now); next = sch.Next(next) {
+		fire_at = next
+	}
+	return fire_at
+}
+
+// Run runs the job after the lease of it is acquired if db_lock is enabled.
+// The run is dropped if it is taken by the other daemon already, or the job
+// is running on the other daemon.
+func (self *JobFromDB) Run() {
+	if !*db_lock || nil == self.backend {
+		self.ShellJob.Run()
+		return
+	}
+
+	self.lease.lock.Lock()
+	defer self.lease.lock.Unlock()
+
+	now := time.Now()
+	fire_at := self.fireTime(now)
+	ok, owner, e := self.backend.acquireLock(self.id, lockOwner(), fire_at, now, now.Add(lockExpiry()))
+	if nil != e {
+		self.skip("acquire the lease failed, " + e.Error())
+		return
+	}
+	if !ok {
+		log.Println("[" + self.name + "] the run of " + fire_at.Format(time.RFC3339) + " is taken or the job is running by '" + owner + "', skip it.")
+		return
+	}
+	self.lease.started_at = now
+	self.lease.renewed_at = now
+	if nil == self.lease.stop {
+		self.lease.stop = make(chan struct{})
+		go self.renewLease(self.lease.stop)
+	}
+	self.ShellJob.Run()
+}
+
+// renewLease renews the lease while the job is running, the job is
+// interrupted if the lease is lost, so that it isn't run on two daemons.
+func (self *JobFromDB) renewLease(stop chan struct{}) {
+	ticker := time.NewTicker(lockExpiry() / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		now := time.Now()
+		ok, e := self.backend.renewLock(self.id, lockOwner(), now.Add(lockExpiry()))
+		if nil == e && ok {
+			self.lease.lock.Lock()
+			self.lease.renewed_at = now
+			self.lease.lock.Unlock()
+			continue
+		}
+
+		if nil != e {
+			log.Println("["+self.name+"] renew the lease failed,", e)
+			self.lease.lock.Lock()
+			is_expired := now.Sub(self.lease.renewed_at) >= lockExpiry()
+			self.lease.lock.Unlock()
+			if !is_expired {
+				continue
+			}
+			log.Println("[" + self.name + "] the lease is expired.")
+		} else {
+			log.Println("[" + self.name + "] the lease is lost, it is taken by the other daemon.")
+		}
+		if e := self.interrupt(); nil != e {
+			log.Println("["+self.name+"] interrupt failed,", e)
+		}
+		return
+	}
+}
+
+// releaseTime returns the time that the lease is released at. The lease of
+// '@every' is kept until the next activation after the last run that is
+// started at started_at, so that the daemons that are started at the
+// different time don't run the job in the same interval.
+func (self *JobFromDB) releaseTime(started_at, now time.Time) time.Time {
+	interval := self.everyInterval()
+	if 0 >= interval {
+		return now
+	}
+	if next := started_at.Add(interval + fireTolerance); next.After(now) {
+		return next
+	}
+	return now
+}
+
+// releaseLease releases the lease after the last run of the job is finished.
+func (self *JobFromDB) releaseLease() {
+	self.lease.lock.Lock()
+	defer self.lease.lock.Unlock()
+
+	if nil == self.lease.stop || self.isRunning() {
+		return
+	}
+	close(self.lease.stop)
+	self.lease.stop = nil
+
+	if _, e := self.backend.renewLock(self.id, lockOwner(), self.releaseTime(self.lease.started_at, time.Now())); nil != e {
+		log.Println("["+self.name+"] release the lease failed,", e)
+	}
+}
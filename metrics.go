@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/runner-mei/cron"
+)
+
+// durationBuckets is the upper bounds(in seconds) of the buckets of the run
+// duration histogram.
+var durationBuckets = []float64{1, 5, 10, 30, 60, 300, 600, 1800, 3600}
+
+var db_poll = &pollMetrics{}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func (self *histogram) observe(v float64) {
+	if nil == self.counts {
+		self.counts = make([]uint64, len(durationBuckets))
+	}
+	for idx, bound := range durationBuckets {
+		if v <= bound {
+			self.counts[idx]++
+		}
+	}
+	self.count++
+	self.sum += v
+}
+
+// pollMetrics is the metrics of polling the jobs from the db.
+type pollMetrics struct {
+	lock     sync.Mutex
+	count    uint64
+	failures uint64
+	latency  histogram
+	last     time.Duration
+}
+
+func (self *pollMetrics) observe(latency time.Duration, e error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.count++
+	if nil != e {
+		self.failures++
+	}
+	self.last = latency
+	self.latency.observe(latency.Seconds())
+}
+
+// jobMetrics is a copy of the counters of a job.
+type jobMetrics struct {
+	id              string
+	name            string
+	runs            int
+	failures        int
+	timeouts        int
+	skipped         int
+	running         bool
+	last_success_at time.Time
+	next_at         time.Time
+	durations       histogram
+}
+
+func (self *ShellJob) metrics() jobMetrics {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	m := jobMetrics{name: self.name,
+		runs:            self.total_runs,
+		failures:        self.failures,
+		timeouts:        self.timeouts,
+		skipped:         self.skipped,
+		running:         0 != len(self.instances),
+		last_success_at: self.last_success_at,
+		durations:       self.durations}
+	m.durations.counts = append([]uint64(nil), self.durations.counts...)
+	return m
+}
+
+type metricsWriter struct {
+	bytes.Buffer
+}
+
+func (self *metricsWriter) header(name, typ, help string) {
+	self.WriteString("# HELP " + name + " " + help + "\n")
+	self.WriteString("# TYPE " + name + " " + typ + "\n")
+}
+
+func (self *metricsWriter) sample(name, labels string, value interface{}) {
+	self.WriteString(name)
+	if "" != labels {
+		self.WriteString("{" + labels + "}")
+	}
+	self.WriteString(" " + formatValue(value) + "\n")
+}
+
+func (self *metricsWriter) histogram(name, labels string, h histogram) {
+	prefix := labels
+	if "" != prefix {
+		prefix += ","
+	}
+	for idx, bound := range durationBuckets {
+		var count uint64
+		if idx < len(h.counts) {
+			count = h.counts[idx]
+		}
+		self.sample(name+"_bucket", prefix+"le=\""+formatValue(bound)+"\"", count)
+	}
+	self.sample(name+"_bucket", prefix+"le=\"+Inf\"", h.count)
+	self.sample(name+"_sum", labels, h.sum)
+	self.sample(name+"_count", labels, h.count)
+}
+
+func formatValue(value interface{}) string {
+	switch v := value.(type) {
+	case bool:
+		if v {
+			return "1"
+		}
+		return "0"
+	case time.Time:
+		if v.IsZero() {
+			return "0"
+		}
+		return fmt.Sprint(float64(v.UnixNano()) / 1e9)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+var labelEscaper = strings.NewReplacer("\\", "\\\\", "\"", "\\\"", "\n", "\\n")
+
+func jobLabels(m *jobMetrics) string {
+	return "id=\"" + labelEscaper.Replace(m.id) + "\",job=\"" + labelEscaper.Replace(m.name) + "\""
+}
+
+// metricsServer exports the metrics of the scheduler and the jobs in the
+// prometheus text format.
+type metricsServer struct {
+	cr         *cron.Cron
+	error_jobs *errorJobs
+}
+
+func (self *metricsServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var jobs []jobMetrics
+	for _, ent := range self.cr.Entries() {
+		job, _ := toShellJob(ent.Job)
+		if nil == job {
+			continue
+		}
+		m := job.metrics()
+		m.id = ent.Id
+		m.next_at = ent.Next
+		jobs = append(jobs, m)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].id < jobs[j].id })
+
+	var out metricsWriter
+	for _, metric := range []struct {
+		name, typ, help string
+		value           func(m *jobMetrics) interface{}
+	}{{"sched_job_runs_total", "counter", "The count of the runs of the job.", func(m *jobMetrics) interface{} { return m.runs }},
+		{"sched_job_failures_total", "counter", "The count of the failed runs(includes the timeout runs) of the job.", func(m *jobMetrics) interface{} { return m.failures }},
+		{"sched_job_timeouts_total", "counter", "The count of the timeout runs of the job.", func(m *jobMetrics) interface{} { return m.timeouts }},
+		{"sched_job_skipped_total", "counter", "The count of the overlapping runs that are skipped.", func(m *jobMetrics) interface{} { return m.skipped }},
+		{"sched_job_running", "gauge", "Whether the job is running.", func(m *jobMetrics) interface{} { return m.running }},
+		{"sched_job_last_success_timestamp_seconds", "gauge", "The end time of the last successful run of the job.", func(m *jobMetrics) interface{} { return m.last_success_at }},
+		{"sched_job_next_run_timestamp_seconds", "gauge", "The next scheduled time of the job.", func(m *jobMetrics) interface{} { return m.next_at }}} {
+		out.header(metric.name, metric.typ, metric.help)
+		for idx := range jobs {
+			out.sample(metric.name, jobLabels(&jobs[idx]), metric.value(&jobs[idx]))
+		}
+	}
+
+	out.header("sched_job_duration_seconds", "histogram", "The duration of the runs of the job.")
+	for idx := range jobs {
+		out.histogram("sched_job_duration_seconds", jobLabels(&jobs[idx]), jobs[idx].durations)
+	}
+
+	out.header("sched_load_errors", "gauge", "The count of the jobs that are failed to load.")
+	out.sample("sched_load_errors", "", self.error_jobs.count())
+
+	stats := workers.stats()
+	out.header("sched_pool_running", "gauge", "The count of the job processes that are running.")
+	out.sample("sched_pool_running", "", stats["running"])
+	out.header("sched_pool_queue_depth", "gauge", "The count of the runs that wait for a worker.")
+	out.sample("sched_pool_queue_depth", "", stats["queue_depth"])
+
+	db_poll.lock.Lock()
+	out.header("sched_db_polls_total", "counter", "The count of polling the jobs from the db.")
+	out.sample("sched_db_polls_total", "", db_poll.count)
+	out.header("sched_db_poll_failures_total", "counter", "The count of the failures of polling the jobs from the db.")
+	out.sample("sched_db_poll_failures_total", "", db_poll.failures)
+	out.header("sched_db_poll_last_latency_seconds", "gauge", "The latency of the last polling.")
+	out.sample("sched_db_poll_last_latency_seconds", "", db_poll.last.Seconds())
+	out.header("sched_db_poll_latency_seconds", "histogram", "The latency of polling the jobs from the db.")
+	out.histogram("sched_db_poll_latency_seconds", "", db_poll.latency)
+	db_poll.lock.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(out.Bytes())
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/cron"
+)
+
+func TestMetrics(t *testing.T) {
+	job := &ShellJob{name: "abc"}
+	now := time.Now()
+	job.record(&jobRun{begin_at: now, end_at: now.Add(2 * time.Second), status: RUN_OK})
+	job.record(&jobRun{begin_at: now, end_at: now.Add(20 * time.Second), status: RUN_TIMEOUT})
+	job.skipped = 1
+
+	cr := cron.New()
+	sch, e := Parse("@every 1h")
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	cr.Schedule("abc.json", sch, job)
+
+	srv := &metricsServer{cr: cr, error_jobs: newErrorJobs(map[string]error{"a.json": e})}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+
+	body := w.Body.String()
+	for _, s := range []string{"# TYPE sched_job_runs_total counter\n",
+		"sched_job_runs_total{id=\"abc.json\",job=\"abc\"} 2\n",
+		"sched_job_failures_total{id=\"abc.json\",job=\"abc\"} 1\n",
+		"sched_job_timeouts_total{id=\"abc.json\",job=\"abc\"} 1\n",
+		"sched_job_skipped_total{id=\"abc.json\",job=\"abc\"} 1\n",
+		"sched_job_duration_seconds_bucket{id=\"abc.json\",job=\"abc\",le=\"5\"} 1\n",
+		"sched_job_duration_seconds_bucket{id=\"abc.json\",job=\"abc\",le=\"30\"} 2\n",
+		"sched_job_duration_seconds_bucket{id=\"abc.json\",job=\"abc\",le=\"+Inf\"} 2\n",
+		"sched_job_duration_seconds_sum{id=\"abc.json\",job=\"abc\"} 22\n",
+		"sched_load_errors 1\n"} {
+		if !strings.Contains(body, s) {
+			t.Error("'"+s+"' is missing, ", body)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"log"
+	"os"
+)
+
+// the events that are notified.
+const (
+	EVENT_START    = "start"
+	EVENT_SUCCESS  = "success"
+	EVENT_FAILURE  = "failure"
+	EVENT_TIMEOUT  = "timeout"
+	EVENT_RECOVERY = "recovery"
+	EVENT_SKIPPED  = "skipped"
+)
+
+func isEvent(event string) bool {
+	switch event {
+	case EVENT_START, EVENT_SUCCESS, EVENT_FAILURE, EVENT_TIMEOUT, EVENT_RECOVERY, EVENT_SKIPPED:
+		return true
+	}
+	return false
+}
+
+// defaultEvents is the events that are sent by email if 'events' is missing.
+var defaultEvents = []string{EVENT_FAILURE, EVENT_TIMEOUT, EVENT_RECOVERY, EVENT_SKIPPED}
+
+// notifier sends the notification of a event of the job, values is the
+// arguments of the templates of the notification.
+type notifier interface {
+	notify(job *ShellJob, event string, values map[string]interface{}) error
+}
+
+// notifiers is all the channels of the notifications, it is initialized by
+// setupNotifiers.
+var notifiers []notifier
+
+func setupNotifiers(arguments map[string]interface{}) error {
+	var results []notifier
+	smtp, e := newSMTPNotifier(mapWithDefault(arguments, "smtp", nil))
+	if nil != e {
+		return e
+	}
+	if nil != smtp {
+		results = append(results, smtp)
+	}
+	// the webhook is always enabled, because the urls may be in the jobs.
+	webhook, e := newWebhookNotifier(mapWithDefault(arguments, "webhook", nil))
+	if nil != e {
+		return e
+	}
+	results = append(results, webhook)
+	notifiers = results
+	return nil
+}
+
+func notificationValues(job *ShellJob, event string, run *jobRun) map[string]interface{} {
+	hostname, _ := os.Hostname()
+	job.lock.Lock()
+	failures := job.consecutive_failures
+	job.lock.Unlock()
+	source := "file"
+	if 0 != job.id {
+		source = "db"
+	}
+
+	return map[string]interface{}{"event": event,
+		"id":          job.id,
+		"name":        job.name,
+		"source":      source,
+		"expression":  job.expression,
+		"hostname":    hostname,
+		"failures":    failures,
+		"status":      run.status,
+		"attempt":     run.attempt,
+		"begin_at":    run.begin_at,
+		"end_at":      run.end_at,
+		"duration":    run.end_at.Sub(run.begin_at),
+		"exit_code":   run.ExitCode,
+		"signal":      run.Signal,
+		"is_timeout":  run.IsTimeout,
+		"log_file":    run.log_file,
+		"log_excerpt": run.log_excerpt,
+		"stderr_tail": run.stderr_tail}
+}
+
+// notify sends the notification of the event to all the channels in
+// background.
+func (self *ShellJob) notify(event string, run *jobRun) {
+	if 0 == len(notifiers) {
+		return
+	}
+	values := notificationValues(self, event, run)
+	go func() {
+		for _, n := range notifiers {
+			if e := n.notify(self, event, values); nil != e {
+				log.Println("["+self.name+"] send the notification of "+event+" failed,", e)
+			}
+		}
+	}()
+}
+
+// notifyResult notifies the final result of a run, the recovery is notified
+// while it is ok after a failure is notified.
+func (self *ShellJob) notifyResult(run *jobRun) {
+	self.lock.Lock()
+	is_failing := self.is_failing
+	switch run.status {
+	case RUN_OK:
+		self.is_failing = false
+	case RUN_FAILED, RUN_TIMEOUT:
+		self.is_failing = true
+	}
+	self.lock.Unlock()
+
+	switch run.status {
+	case RUN_OK:
+		self.notify(EVENT_SUCCESS, run)
+		if is_failing {
+			self.notify(EVENT_RECOVERY, run)
+		}
+	case RUN_FAILED:
+		self.notify(EVENT_FAILURE, run)
+	case RUN_TIMEOUT:
+		self.notify(EVENT_TIMEOUT, run)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const defaultSubject = `[scheduler] job '{{.name}}' {{.event}}`
+
+const defaultBody = `job:       {{.name}}
+event:     {{.event}}
+host:      {{.hostname}}
+status:    {{.status}}
+exit code: {{.exit_code}}{{if .signal}}
+signal:    {{.signal}}{{end}}
+begin at:  {{.begin_at}}
+end at:    {{.end_at}}
+failures:  {{.failures}}{{if .log_file}}
+log file:  {{.log_file}}{{end}}{{if .stderr_tail}}
+
+---------------- stderr ----------------
+{{.stderr_tail}}{{end}}{{if .log_excerpt}}
+
+----------------  log   ----------------
+{{.log_excerpt}}{{end}}
+`
+
+// smtpNotifier sends the notifications by email, it is configured by the
+// 'smtp' object of the config:
+//
+//	"smtp": {
+//	  "host": "mail.example.com",
+//	  "port": 25,
+//	  "username": "",
+//	  "password": "",
+//	  "from": "scheduler@example.com",
+//	  "to": ["ops@example.com"],
+//	  "events": ["failure", "timeout", "recovery", "skipped"],
+//	  "subject": "[scheduler] job '{{.name}}' {{.event}}",
+//	  "body": "..."
+//	}
+//
+// the recipients are overridden by 'notify_to' of the job.
+type smtpNotifier struct {
+	addr    string
+	auth    smtp.Auth
+	from    string
+	to      []string
+	events  map[string]bool
+	subject *template.Template
+	body    *template.Template
+}
+
+func newSMTPNotifier(args map[string]interface{}) (*smtpNotifier, error) {
+	host := stringWithDefault(args, "host", "")
+	if "" == host {
+		return nil, nil
+	}
+
+	from := stringWithDefault(args, "from", "")
+	if "" == from {
+		hostname, _ := os.Hostname()
+		from = "scheduler@" + hostname
+	}
+
+	subject, e := template.New("subject").Parse(stringWithDefault(args, "subject", defaultSubject))
+	if nil != e {
+		return nil, errors.New("parse the subject template of smtp failed, " + e.Error())
+	}
+	body, e := template.New("body").Parse(stringWithDefault(args, "body", defaultBody))
+	if nil != e {
+		return nil, errors.New("parse the body template of smtp failed, " + e.Error())
+	}
+
+	events := map[string]bool{}
+	for _, event := range stringsWithDefault(args, "events", ",", defaultEvents) {
+		event = strings.ToLower(strings.TrimSpace(event))
+		if !isEvent(event) {
+			return nil, errors.New("event '" + event + "' of smtp is unsupported.")
+		}
+		events[event] = true
+	}
+
+	notifier := &smtpNotifier{addr: net.JoinHostPort(host, fmt.Sprint(intWithDefault(args, "port", 25))),
+		from:    from,
+		to:      trimStrings(stringsWithDefault(args, "to", ",", nil)),
+		events:  events,
+		subject: subject,
+		body:    body}
+	if username := stringWithDefault(args, "username", ""); "" != username {
+		notifier.auth = smtp.PlainAuth("", username, stringWithDefault(args, "password", ""), host)
+	}
+	return notifier, nil
+}
+
+func trimStrings(ss []string) []string {
+	var results []string
+	for _, s := range ss {
+		if s = strings.TrimSpace(s); "" != s {
+			results = append(results, s)
+		}
+	}
+	return results
+}
+
+func (self *smtpNotifier) notify(job *ShellJob, event string, values map[string]interface{}) error {
+	if !self.events[event] {
+		return nil
+	}
+	to := self.to
+	if 0 != len(job.notify_to) {
+		to = job.notify_to
+	}
+	if 0 == len(to) {
+		return nil
+	}
+
+	var subject, body bytes.Buffer
+	if e := self.subject.Execute(&subject, values); nil != e {
+		return errors.New("generate the subject failed, " + e.Error())
+	}
+	if e := self.body.Execute(&body, values); nil != e {
+		return errors.New("generate the body failed, " + e.Error())
+	}
+
+	var msg bytes.Buffer
+	msg.WriteString("From: " + self.from + "\r\n")
+	msg.WriteString("To: " + strings.Join(to, ", ") + "\r\n")
+	msg.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", strings.TrimSpace(subject.String())) + "\r\n")
+	msg.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.Replace(strings.Replace(body.String(), "\r\n", "\n", -1), "\n", "\r\n", -1))
+
+	return smtp.SendMail(self.addr, self.auth, self.from, to, msg.Bytes())
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+type mail struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpStandIn accepts the mails without the authentication, and sends them to
+// the channel.
+func smtpStandIn(t *testing.T) (string, chan *mail, func()) {
+	listener, e := net.Listen("tcp", "127.0.0.1:0")
+	if nil != e {
+		t.Fatal(e)
+	}
+	mails := make(chan *mail, 10)
+	go func() {
+		for {
+			conn, e := listener.Accept()
+			if nil != e {
+				return
+			}
+			go serveSMTP(conn, mails)
+		}
+	}()
+	return listener.Addr().String(), mails, func() { listener.Close() }
+}
+
+func serveSMTP(conn net.Conn, mails chan *mail) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	m := &mail{}
+	for {
+		line, e := reader.ReadString('\n')
+		if nil != e {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM:"):
+			m.from = strings.Trim(line[len("MAIL FROM:"):], "<> ")
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO:"):
+			m.to = append(m.to, strings.Trim(line[len("RCPT TO:"):], "<> "))
+			reply("250 ok")
+		case "DATA" == cmd:
+			reply("354 go ahead")
+			var data []string
+			for {
+				s, e := reader.ReadString('\n')
+				if nil != e {
+					return
+				}
+				if ".\r\n" == s {
+					break
+				}
+				data = append(data, s)
+			}
+			m.data = strings.Join(data, "")
+			mails <- m
+			m = &mail{}
+			reply("250 ok")
+		case "QUIT" == cmd:
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	addr, mails, closer := smtpStandIn(t)
+	defer closer()
+	host, port, _ := net.SplitHostPort(addr)
+
+	n, e := newSMTPNotifier(map[string]interface{}{"host": host,
+		"port":    port,
+		"from":    "sched@example.com",
+		"to":      []interface{}{"ops@example.com"},
+		"events":  "failure, recovery",
+		"subject": "{{.name}} is {{.event}}"})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+
+	job := &ShellJob{name: "abc"}
+	now := time.Now()
+	run := &jobRun{begin_at: now, end_at: now, status: RUN_FAILED, stderr_tail: "no such file", RunResult: RunResult{ExitCode: 2}}
+	if e := n.notify(job, EVENT_TIMEOUT, notificationValues(job, EVENT_TIMEOUT, run)); nil != e {
+		t.Error(e)
+	}
+	if e := n.notify(job, EVENT_FAILURE, notificationValues(job, EVENT_FAILURE, run)); nil != e {
+		t.Error(e)
+	}
+	job.notify_to = []string{"a@example.com", "b@example.com"}
+	if e := n.notify(job, EVENT_RECOVERY, notificationValues(job, EVENT_RECOVERY, run)); nil != e {
+		t.Error(e)
+	}
+
+	m := <-mails
+	if "sched@example.com" != m.from || 1 != len(m.to) || "ops@example.com" != m.to[0] {
+		t.Error("envelope is error, ", m.from, m.to)
+	}
+	for _, s := range []string{"Subject: abc is failure\r\n", "exit code: 2\r\n", "no such file"} {
+		if !strings.Contains(m.data, s) {
+			t.Error("'"+s+"' is missing, ", m.data)
+		}
+	}
+
+	m = <-mails
+	if 2 != len(m.to) || "a@example.com" != m.to[0] || "b@example.com" != m.to[1] {
+		t.Error("recipients of the job is error, ", m.to)
+	}
+	if !strings.Contains(m.data, "Subject: abc is recovery\r\n") {
+		t.Error("subject is error, ", m.data)
+	}
+
+	select {
+	case m = <-mails:
+		t.Error("the event isn't filtered, ", m.data)
+	default:
+	}
+}
+
+type notifierFunc func(job *ShellJob, event string, values map[string]interface{}) error
+
+func (self notifierFunc) notify(job *ShellJob, event string, values map[string]interface{}) error {
+	return self(job, event, values)
+}
+
+func TestNotifyEvents(t *testing.T) {
+	events := make(chan string, 10)
+	notifiers = []notifier{notifierFunc(func(job *ShellJob, event string, values map[string]interface{}) error {
+		if EVENT_START != event && EVENT_SUCCESS != event {
+			events <- event + ":" + values["status"].(string)
+		}
+		return nil
+	})}
+	defer func() {
+		notifiers = nil
+	}()
+
+	shellJobTest(t, func(dir string, job *ShellJob) {
+		for _, test := range []struct {
+			script string
+			event  string
+		}{{script: "exit 0"},
+			{script: "exit 1", event: "failure:failed"},
+			{script: "exit 1", event: "failure:failed"},
+			{script: "exit 0", event: "recovery:ok"},
+			{script: "exit 0"}} {
+			job.arguments = []string{"-c", test.script}
+			job.runWithRetries(newRunInstance())
+
+			var event string
+			select {
+			case event = <-events:
+			case <-time.After(100 * time.Millisecond):
+			}
+			if test.event != event {
+				t.Error(test.script, "event is error, excepted is", test.event, "actual is", event)
+			}
+		}
+
+		job.skip("running")
+		if event := <-events; "skipped:skipped" != event {
+			t.Error("event is error, ", event)
+		}
+	})
+}
+
+func TestDefaultEventsOfSMTP(t *testing.T) {
+	n, e := newSMTPNotifier(map[string]interface{}{"host": "127.0.0.1", "from": "sched@example.com", "to": "ops@example.com"})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	for _, event := range []string{EVENT_FAILURE, EVENT_TIMEOUT, EVENT_RECOVERY, EVENT_SKIPPED} {
+		if !n.events[event] {
+			t.Error("'"+event+"' isn't notified by default, ", n.events)
+		}
+	}
+	if n.events[EVENT_START] || n.events[EVENT_SUCCESS] {
+		t.Error("events is error, ", n.events)
+	}
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const signatureHeader = "X-Sched-Signature"
+
+// webhookNotifier posts the events as json to the urls, it is configured by
+// the 'webhook' object of the config:
+//
+//	"webhook": {
+//	  "urls": ["http://example.com/hook"],
+//	  "secret": "abc",
+//	  "events": ["start", "success", "failure", "timeout"],
+//	  "retries": 3,
+//	  "retry_delay": "5s",
+//	  "timeout": "10s"
+//	}
+//
+// the urls in 'webhooks' of the job are posted too. The body is signed by
+// HMAC-SHA256 with the secret, the signature is sent in the header
+// 'X-Sched-Signature' as 'sha256=<hex>'.
+type webhookNotifier struct {
+	urls        []string
+	secret      []byte
+	events      map[string]bool
+	retries     int
+	retry_delay time.Duration
+	client      *http.Client
+}
+
+var defaultWebhookEvents = []string{EVENT_START, EVENT_SUCCESS, EVENT_FAILURE, EVENT_TIMEOUT}
+
+func newWebhookNotifier(args map[string]interface{}) (*webhookNotifier, error) {
+	events := map[string]bool{}
+	for _, event := range stringsWithDefault(args, "events", ",", defaultWebhookEvents) {
+		event = strings.ToLower(strings.TrimSpace(event))
+		if !isEvent(event) {
+			return nil, errors.New("event '" + event + "' of webhook is unsupported.")
+		}
+		events[event] = true
+	}
+
+	return &webhookNotifier{urls: trimStrings(stringsWithDefault(args, "urls", ",", nil)),
+		secret:      []byte(stringWithDefault(args, "secret", "")),
+		events:      events,
+		retries:     intWithDefault(args, "retries", 3),
+		retry_delay: durationWithDefault(args, "retry_delay", 5*time.Second),
+		client:      &http.Client{Timeout: durationWithDefault(args, "timeout", 10*time.Second)}}, nil
+}
+
+func webhookPayload(values map[string]interface{}) map[string]interface{} {
+	payload := map[string]interface{}{}
+	for _, key := range []string{"event", "id", "name", "source", "hostname", "status", "attempt",
+		"begin_at", "end_at", "exit_code", "signal", "is_timeout", "log_file", "stderr_tail"} {
+		payload[key] = values[key]
+	}
+	if duration, ok := values["duration"].(time.Duration); ok {
+		payload["duration"] = duration.Seconds()
+	}
+	payload["log_tail"] = values["log_excerpt"]
+	return payload
+}
+
+func (self *webhookNotifier) notify(job *ShellJob, event string, values map[string]interface{}) error {
+	if !self.events[event] {
+		return nil
+	}
+	urls := append(append([]string(nil), self.urls...), job.webhooks...)
+	if 0 == len(urls) {
+		return nil
+	}
+
+	body, e := json.Marshal(webhookPayload(values))
+	if nil != e {
+		return e
+	}
+	signature := ""
+	if 0 != len(self.secret) {
+		mac := hmac.New(sha256.New, self.secret)
+		mac.Write(body)
+		signature = "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	var errs []string
+	for _, url := range urls {
+		if e := self.post(url, event, signature, body); nil != e {
+			errs = append(errs, e.Error())
+		}
+	}
+	if 0 != len(errs) {
+		return errors.New(strings.Join(errs, "\r\n"))
+	}
+	return nil
+}
+
+// post sends the body to the url, it is retried at most retries times while
+// it is failed.
+func (self *webhookNotifier) post(url, event, signature string, body []byte) error {
+	delay := self.retry_delay
+	for attempt := 0; ; attempt++ {
+		e := self.postOnce(url, event, signature, body)
+		if nil == e {
+			return nil
+		}
+		if attempt >= self.retries {
+			return errors.New("post to '" + url + "' failed, " + e.Error())
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (self *webhookNotifier) postOnce(url, event, signature string, body []byte) error {
+	req, e := http.NewRequest("POST", url, bytes.NewReader(body))
+	if nil != e {
+		return e
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("X-Sched-Event", event)
+	if "" != signature {
+		req.Header.Set(signatureHeader, signature)
+	}
+
+	resp, e := self.client.Do(req)
+	if nil != e {
+		return e
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return errors.New("status is " + fmt.Sprint(resp.StatusCode))
+	}
+	return nil
+}
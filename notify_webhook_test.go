@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	var lock sync.Mutex
+	var requests []*http.Request
+	var bodies [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		bs, _ := ioutil.ReadAll(r.Body)
+		lock.Lock()
+		requests = append(requests, r)
+		bodies = append(bodies, bs)
+		count := len(requests)
+		lock.Unlock()
+
+		// the first delivery is failed, it must be retried.
+		if 1 == count {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	n, e := newWebhookNotifier(map[string]interface{}{"secret": "abc",
+		"events":      "success, failure",
+		"retries":     2,
+		"retry_delay": "10ms"})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+
+	job := &ShellJob{id: 12, name: "abc", webhooks: []string{srv.URL + "/hook"}}
+	now := time.Now()
+	run := &jobRun{attempt: 1, begin_at: now, end_at: now.Add(time.Second), status: RUN_FAILED, log_excerpt: "error", RunResult: RunResult{ExitCode: 2}}
+	if e := n.notify(job, EVENT_START, notificationValues(job, EVENT_START, run)); nil != e {
+		t.Error(e)
+	}
+	if e := n.notify(job, EVENT_FAILURE, notificationValues(job, EVENT_FAILURE, run)); nil != e {
+		t.Error(e)
+		return
+	}
+
+	if 2 != len(requests) {
+		t.Error("count of the requests is error, ", len(requests))
+		return
+	}
+	r := requests[1]
+	if "/hook" != r.URL.Path || EVENT_FAILURE != r.Header.Get("X-Sched-Event") {
+		t.Error("request is error, ", r.URL.Path, r.Header)
+	}
+	mac := hmac.New(sha256.New, []byte("abc"))
+	mac.Write(bodies[1])
+	if "sha256="+hex.EncodeToString(mac.Sum(nil)) != r.Header.Get(signatureHeader) {
+		t.Error("signature is error, ", r.Header.Get(signatureHeader))
+	}
+
+	var payload map[string]interface{}
+	if e := json.Unmarshal(bodies[1], &payload); nil != e {
+		t.Error(e)
+		return
+	}
+	for key, excepted := range map[string]interface{}{"event": "failure",
+		"id":        float64(12),
+		"name":      "abc",
+		"source":    "db",
+		"status":    RUN_FAILED,
+		"exit_code": float64(2),
+		"duration":  float64(1),
+		"log_tail":  "error"} {
+		if excepted != payload[key] {
+			t.Error(key, "is error, excepted is", excepted, "actual is", payload[key])
+		}
+	}
+
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	job.webhooks = []string{closed.URL + "/hook"}
+	if e := n.notify(job, EVENT_SUCCESS, notificationValues(job, EVENT_SUCCESS, run)); nil == e {
+		t.Error("excepted error")
+	}
+}
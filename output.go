@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// the modes of capturing the output of the job process.
+const (
+	OUTPUT_MERGED   = "merged"   // stdout and stderr are written into the log file as is
+	OUTPUT_SEPARATE = "separate" // stderr is written into the file job_<name>.err.log
+	OUTPUT_TAGGED   = "tagged"   // the same as merged, and log_timestamp is enabled
+)
+
+const (
+	defaultStderrTailBytes = 4 * 1024
+	outputTimeLayout       = "2006-01-02 15:04:05.000"
+
+	// pipeWaitDelay is the time of waiting for the rest of the output after
+	// the process is exited, while the output is written through a pipe.
+	pipeWaitDelay = 1 * time.Second
+)
+
+// errLogFile returns the file of stderr while the output is separate.
+func errLogFile(logfile string) string {
+	if strings.HasSuffix(logfile, ".log") {
+		return strings.TrimSuffix(logfile, ".log") + ".err.log"
+	}
+	return logfile + ".err"
+}
+
+// lockedWriter serializes the writes of the streams into the same file.
+type lockedWriter struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func (self *lockedWriter) Write(p []byte) (int, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return self.w.Write(p)
+}
+
+// lineWriter writes every line with the prefix that is returned by prefix,
+// the last line without the line break is kept until Flush is called.
+type lineWriter struct {
+	w      io.Writer
+	prefix func() string
+	buffer []byte
+}
+
+func newLineWriter(w io.Writer, stream string) *lineWriter {
+	return &lineWriter{w: w, prefix: func() string {
+		return time.Now().Format(outputTimeLayout) + " [" + stream + "] "
+	}}
+}
+
+func (self *lineWriter) Write(p []byte) (int, error) {
+	self.buffer = append(self.buffer, p...)
+	for {
+		idx := bytes.IndexByte(self.buffer, '\n')
+		if idx < 0 {
+			return len(p), nil
+		}
+		if e := self.writeLine(self.buffer[:idx+1]); nil != e {
+			return len(p), e
+		}
+		self.buffer = self.buffer[idx+1:]
+	}
+}
+
+func (self *lineWriter) writeLine(line []byte) error {
+	bs := make([]byte, 0, len(line)+32)
+	bs = append(bs, self.prefix()...)
+	bs = append(bs, line...)
+	_, e := self.w.Write(bs)
+	return e
+}
+
+func (self *lineWriter) Flush() error {
+	if 0 == len(self.buffer) {
+		return nil
+	}
+	line := append(self.buffer, '\n')
+	self.buffer = nil
+	return self.writeLine(line)
+}
+
+// tailBuffer keeps the last max bytes that are written.
+type tailBuffer struct {
+	lock   sync.Mutex
+	max    int
+	buffer []byte
+}
+
+func (self *tailBuffer) Write(p []byte) (int, error) {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	self.buffer = append(self.buffer, p...)
+	if len(self.buffer) > self.max {
+		self.buffer = append(self.buffer[:0], self.buffer[len(self.buffer)-self.max:]...)
+	}
+	return len(p), nil
+}
+
+func (self *tailBuffer) String() string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return string(self.buffer)
+}
+
+// openStreams returns the writers of stdout and stderr of the job process by
+// the output mode, every line is prefixed with the time and the stream name if
+// log_timestamp is enabled. The log files are returned as is if the lines
+// aren't prefixed, so that they are inherited by the process directly. The
+// returned function must be called after the process is exited.
+func (self *ShellJob) openStreams(logfile string, out *os.File, shared *lockedWriter) (io.Writer, io.Writer, func(), error) {
+	if OUTPUT_SEPARATE == self.output {
+		errout, e := os.OpenFile(errLogFile(logfile), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0666)
+		if nil != e {
+			return nil, nil, nil, e
+		}
+		if !self.log_timestamp {
+			return out, errout, func() { errout.Close() }, nil
+		}
+
+		stdout := newLineWriter(shared, "out")
+		stderr := newLineWriter(errout, "err")
+		return stdout, stderr, func() {
+			stdout.Flush()
+			stderr.Flush()
+			errout.Close()
+		}, nil
+	}
+
+	if !self.log_timestamp && OUTPUT_TAGGED != self.output {
+		return out, out, func() {}, nil
+	}
+	stdout := newLineWriter(shared, "out")
+	stderr := newLineWriter(shared, "err")
+	return stdout, stderr, func() {
+		stdout.Flush()
+		stderr.Flush()
+	}, nil
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLineWriter(t *testing.T) {
+	var buffer bytes.Buffer
+	w := &lineWriter{w: &buffer, prefix: func() string { return "> " }}
+	w.Write([]byte("a"))
+	w.Write([]byte("b\nc\n\nd"))
+	if "> ab\n> c\n> \n" != buffer.String() {
+		t.Errorf("output is error, %q", buffer.String())
+	}
+	w.Flush()
+	if "> ab\n> c\n> \n> d\n" != buffer.String() {
+		t.Errorf("output is error, %q", buffer.String())
+	}
+}
+
+func TestTailBuffer(t *testing.T) {
+	w := &tailBuffer{max: 4}
+	w.Write([]byte("ab"))
+	w.Write([]byte("cdef"))
+	if "cdef" != w.String() {
+		t.Error("tail is error, ", w.String())
+	}
+	w.Write([]byte("g"))
+	if "defg" != w.String() {
+		t.Error("tail is error, ", w.String())
+	}
+}
+
+func TestOutputOfJob(t *testing.T) {
+	shellJobTest(t, func(dir string, job *ShellJob) {
+		job.arguments = []string{"-c", "echo out1; echo err1 1>&2; echo out2"}
+		job.stderr_tail_bytes = 3
+
+		job.output = OUTPUT_SEPARATE
+		run := job.do_run(newRunInstance(), 0)
+		if RUN_OK != run.status || "r1\n" != run.stderr_tail {
+			t.Errorf("run is error, %v %q", run.status, run.stderr_tail)
+		}
+		bs, _ := ioutil.ReadFile(job.logfile)
+		if !strings.Contains(string(bs), "out1\nout2\n") || strings.Contains(string(bs), "\nerr1\n") {
+			t.Error("stdout is error, ", string(bs))
+		}
+		bs, _ = ioutil.ReadFile(errLogFile(job.logfile))
+		if "err1\n" != string(bs) {
+			t.Error("stderr is error, ", string(bs))
+		}
+
+		job.output = OUTPUT_TAGGED
+		run = job.do_run(newRunInstance(), 0)
+		if RUN_OK != run.status {
+			t.Error("run is error, ", run.status)
+		}
+		for _, pattern := range []string{`\n\d{4}-\d\d-\d\d \d\d:\d\d:\d\d\.\d{3} \[out\] out1\n`,
+			`\n\d{4}-\d\d-\d\d \d\d:\d\d:\d\d\.\d{3} \[err\] err1\n`,
+			`\n\d{4}-\d\d-\d\d \d\d:\d\d:\d\d\.\d{3} \[out\] out2\n`} {
+			if !regexp.MustCompile(pattern).MatchString(run.log_excerpt) {
+				t.Error(pattern, "is missing, ", run.log_excerpt)
+			}
+		}
+	})
+}
+
+func TestTimestampOfJob(t *testing.T) {
+	shellJobTest(t, func(dir string, job *ShellJob) {
+		job.arguments = []string{"-c", "echo out1; echo err1 1>&2; printf out2"}
+		job.output = OUTPUT_SEPARATE
+		job.log_timestamp = true
+
+		run := job.do_run(newRunInstance(), 0)
+		if RUN_OK != run.status {
+			t.Error("run is error, ", run.status)
+		}
+		for _, pattern := range []string{`^=+ begin at \d{4}-\d\d-\d\d \d\d:\d\d:\d\d\.\d{3} =+\r\n`,
+			`\n\d{4}-\d\d-\d\d \d\d:\d\d:\d\d\.\d{3} \[out\] out1\n`,
+			`\n\d{4}-\d\d-\d\d \d\d:\d\d:\d\d\.\d{3} \[out\] out2\n`,
+			`\n=+  end at \d{4}-\d\d-\d\d \d\d:\d\d:\d\d\.\d{3}, duration [0-9.]+[µnm]?s =+\r\n$`} {
+			if !regexp.MustCompile(pattern).MatchString(run.log_excerpt) {
+				t.Error(pattern, "is missing, ", run.log_excerpt)
+			}
+		}
+
+		bs, _ := ioutil.ReadFile(errLogFile(job.logfile))
+		if !regexp.MustCompile(`^\d{4}-\d\d-\d\d \d\d:\d\d:\d\d\.\d{3} \[err\] err1\n$`).Match(bs) {
+			t.Error("stderr is error, ", string(bs))
+		}
+	})
+}
+
+func TestBackgroundChildOfJob(t *testing.T) {
+	shellJobTest(t, func(dir string, job *ShellJob) {
+		job.arguments = []string{"-c", "sleep 5 & echo started"}
+		job.timeout = 3 * time.Second
+		job.stderr_tail_bytes = defaultStderrTailBytes
+
+		// the job isn't waited for the child that inherits the output.
+		for _, is_timestamp := range []bool{false, true} {
+			job.log_timestamp = is_timestamp
+			started_at := time.Now()
+			run := job.do_run(newRunInstance(), 0)
+			if RUN_OK != run.status {
+				t.Error("run is error, ", is_timestamp, run.status, run.log_excerpt)
+			}
+			if elapsed := time.Now().Sub(started_at); elapsed > 2*time.Second {
+				t.Error("run is waited for the child, ", is_timestamp, elapsed)
+			}
+		}
+	})
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"container/heap"
+	"flag"
+	"sync"
+)
+
+var (
+	max_concurrency = flag.Int("max_concurrency", 0, "the max number of the job processes that run at the same time, it is unlimited if it is 0")
+
+	workers = &workerPool{}
+)
+
+type waiter struct {
+	priority int
+	seq      uint64
+	c        chan struct{}
+}
+
+// waitQueue is a priority queue, the waiter with the higher priority is the
+// first, and the waiters with the same priority are FIFO.
+type waitQueue []*waiter
+
+func (self waitQueue) Len() int { return len(self) }
+func (self waitQueue) Less(i, j int) bool {
+	if self[i].priority != self[j].priority {
+		return self[i].priority > self[j].priority
+	}
+	return self[i].seq < self[j].seq
+}
+func (self waitQueue) Swap(i, j int) { self[i], self[j] = self[j], self[i] }
+func (self *waitQueue) Push(x interface{}) {
+	*self = append(*self, x.(*waiter))
+}
+func (self *waitQueue) Pop() interface{} {
+	old := *self
+	n := len(old)
+	x := old[n-1]
+	old[n-1] = nil
+	*self = old[:n-1]
+	return x
+}
+
+// workerPool limits the number of the job processes that run at the same time.
+type workerPool struct {
+	lock     sync.Mutex
+	max      int
+	running  int
+	seq      uint64
+	waitings waitQueue
+}
+
+func (self *workerPool) setMax(max int) {
+	self.lock.Lock()
+	self.max = max
+	self.lock.Unlock()
+	self.dispatch()
+}
+
+// acquire blocks until a process of the job is allowed to start.
+func (self *workerPool) acquire(priority int) {
+	self.lock.Lock()
+	if (0 >= self.max || self.running < self.max) && 0 == len(self.waitings) {
+		self.running++
+		self.lock.Unlock()
+		return
+	}
+
+	self.seq++
+	w := &waiter{priority: priority, seq: self.seq, c: make(chan struct{})}
+	heap.Push(&self.waitings, w)
+	self.lock.Unlock()
+	<-w.c
+}
+
+func (self *workerPool) release() {
+	self.lock.Lock()
+	self.running--
+	self.lock.Unlock()
+	self.dispatch()
+}
+
+func (self *workerPool) dispatch() {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	for 0 != len(self.waitings) && (0 >= self.max || self.running < self.max) {
+		w := heap.Pop(&self.waitings).(*waiter)
+		self.running++
+		close(w.c)
+	}
+}
+
+func (self *workerPool) stats() map[string]interface{} {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	return map[string]interface{}{"max_concurrency": self.max,
+		"running":     self.running,
+		"queue_depth": len(self.waitings)}
+}
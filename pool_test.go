@@ -0,0 +1,50 @@
+package main
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWorkerPool(t *testing.T) {
+	pool := &workerPool{}
+	pool.setMax(1)
+	pool.acquire(0)
+
+	var lock sync.Mutex
+	var orders []int
+	var wait sync.WaitGroup
+	for idx, priority := range []int{0, 5, 0, 3} {
+		wait.Add(1)
+		go func(idx, priority int) {
+			defer wait.Done()
+			pool.acquire(priority)
+			lock.Lock()
+			orders = append(orders, idx)
+			lock.Unlock()
+			pool.release()
+		}(idx, priority)
+
+		for started_at := time.Now(); idx+1 != pool.stats()["queue_depth"]; time.Sleep(time.Millisecond) {
+			if time.Now().Sub(started_at) > time.Second {
+				t.Error("wait queue timeout")
+				return
+			}
+		}
+	}
+
+	if 1 != pool.stats()["running"] {
+		t.Error("running is error, ", pool.stats())
+	}
+
+	pool.release()
+	wait.Wait()
+
+	if !reflect.DeepEqual([]int{1, 3, 0, 2}, orders) {
+		t.Error("orders is error, ", orders)
+	}
+	if 0 != pool.stats()["running"] || 0 != pool.stats()["queue_depth"] {
+		t.Error("stats is error, ", pool.stats())
+	}
+}
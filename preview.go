@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/runner-mei/cron"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	month_names = []string{"", "January", "February", "March", "April", "May", "June",
+		"July", "August", "September", "October", "November", "December"}
+	week_names = []string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"}
+
+	descriptors = map[string]string{"@yearly": "0 0 0 1 1 *",
+		"@annually": "0 0 0 1 1 *",
+		"@monthly":  "0 0 0 1 * *",
+		"@weekly":   "0 0 0 * * 0",
+		"@daily":    "0 0 0 * * *",
+		"@midnight": "0 0 0 * * *",
+		"@hourly":   "0 0 * * * *"}
+)
+
+// nextTimes returns the next count activation times of sch after from.
+func nextTimes(sch cron.Schedule, from time.Time, count int) []time.Time {
+	results := make([]time.Time, 0, count)
+	for t := from; len(results) < count; {
+		t = sch.Next(t)
+		if t.IsZero() {
+			break
+		}
+		results = append(results, t)
+	}
+	return results
+}
+
+// preview parses spec by the same way of the daemon and returns the next count
+// activation times and the interpretation of it.
+func preview(spec string, count int) (map[string]interface{}, error) {
+	sch, e := Parse(spec)
+	if nil != e {
+		return nil, e
+	}
+	return map[string]interface{}{"expression": spec,
+		"description": describeExpression(spec),
+		"next":        nextTimes(sch, time.Now(), count)}, nil
+}
+
+func isWildcard(s string) bool {
+	return "*" == s || "?" == s
+}
+
+func valueName(s string, names []string) string {
+	if nil == names {
+		return s
+	}
+	i, e := strconv.Atoi(s)
+	if nil != e {
+		for idx, nm := range names {
+			if "" != nm && strings.HasPrefix(strings.ToLower(nm), strings.ToLower(s)) {
+				return names[idx]
+			}
+		}
+		return s
+	}
+	if i >= 0 && i < len(names) {
+		return names[i]
+	}
+	if len(names) == i && 7 == len(names) { // 7 is sunday too
+		return names[0]
+	}
+	return s
+}
+
+// describeRange describes a part of field, such as '1-5', '*/10' or '3'.
+func describeRange(s, unit string, names []string) string {
+	step := ""
+	if idx := strings.IndexRune(s, '/'); idx >= 0 {
+		step = s[idx+1:]
+		s = s[:idx]
+	}
+
+	var text string
+	if idx := strings.IndexRune(s, '-'); idx >= 0 {
+		text = valueName(s[:idx], names) + " through " + valueName(s[idx+1:], names)
+	} else if isWildcard(s) {
+		text = ""
+	} else if "" != step {
+		text = "starting at " + valueName(s, names)
+	} else {
+		text = valueName(s, names)
+	}
+
+	if "" == step {
+		return text
+	}
+	if "" == text {
+		return "every " + step + " " + unit + "s"
+	}
+	return "every " + step + " " + unit + "s " + text
+}
+
+func describeField(s, unit string, names []string) string {
+	ss := strings.Split(s, ",")
+	for idx, v := range ss {
+		ss[idx] = describeRange(v, unit, names)
+	}
+	text := strings.Join(ss, ", ")
+	if strings.HasPrefix(text, "every ") {
+		return text
+	}
+	if 1 == len(ss) && !strings.Contains(text, " ") && nil == names {
+		return unit + " " + text
+	}
+	if nil == names {
+		return unit + "s " + text
+	}
+	return text
+}
+
+func isNumber(s string) bool {
+	_, e := strconv.Atoi(s)
+	return nil == e
+}
+
+func twoDigits(s string) string {
+	if 1 == len(s) {
+		return "0" + s
+	}
+	return s
+}
+
+// describeExpression returns the human-readable interpretation of spec.
+func describeExpression(spec string) string {
+	spec = strings.TrimSpace(spec)
+	if strings.HasPrefix(spec, "@every ") {
+		d, e := time.ParseDuration(strings.TrimSpace(strings.TrimPrefix(spec, "@every ")))
+		if nil != e {
+			return spec
+		}
+		return "every " + d.String()
+	}
+	if s, ok := descriptors[spec]; ok {
+		spec = s
+	}
+
+	fields := strings.Fields(spec)
+	if 5 == len(fields) {
+		fields = append(fields, "*")
+	}
+	if 6 != len(fields) {
+		return spec
+	}
+
+	var buffer bytes.Buffer
+	second, minute, hour := fields[0], fields[1], fields[2]
+	is_daily := isNumber(second) && isNumber(minute) && isNumber(hour)
+	if is_daily {
+		buffer.WriteString("at " + twoDigits(hour) + ":" + twoDigits(minute) + ":" + twoDigits(second))
+	} else {
+		var parts []string
+		for idx, field := range []struct{ value, unit string }{{second, "second"}, {minute, "minute"}, {hour, "hour"}} {
+			if !isWildcard(field.value) {
+				parts = append(parts, describeField(field.value, field.unit, nil))
+				continue
+			}
+			// the wildcard is implied if the smaller field is a wildcard or a step,
+			// '*/10 * *' is 'every 10 seconds'.
+			if 0 != idx && (isWildcard(fields[idx-1]) || strings.Contains(fields[idx-1], "/")) {
+				continue
+			}
+			parts = append(parts, "every "+field.unit)
+		}
+
+		text := strings.Join(parts, ", ")
+		if !strings.HasPrefix(text, "every ") {
+			text = "at " + text
+		}
+		buffer.WriteString(text)
+	}
+
+	day, month, week := fields[3], fields[4], fields[5]
+	if isWildcard(day) && isWildcard(month) && isWildcard(week) {
+		if is_daily {
+			buffer.WriteString(", every day")
+		}
+		return buffer.String()
+	}
+	if !isWildcard(day) {
+		buffer.WriteString(", on " + describeField(day, "day", nil) + " of the month")
+	}
+	if !isWildcard(week) {
+		buffer.WriteString(", on " + describeField(week, "day", week_names))
+	}
+	if !isWildcard(month) {
+		buffer.WriteString(", in " + describeField(month, "month", month_names))
+	}
+	return buffer.String()
+}
+
+func previewText(result map[string]interface{}) string {
+	var buffer bytes.Buffer
+	fmt.Fprintln(&buffer, result["expression"], "-", result["description"])
+	for _, t := range result["next"].([]time.Time) {
+		fmt.Fprintln(&buffer, "    ", t.Format(time.RFC3339))
+	}
+	return buffer.String()
+}
+
+// runPreview prints the preview of spec, spec is a expression, a job file or
+// the id of a job in the db.
+func runPreview(spec string, count int, arguments map[string]interface{}) bool {
+	expression := spec
+	if id, e := strconv.ParseInt(spec, 10, 64); nil == e {
+		backend, e := newBackend(*db_drv, *db_url)
+		if nil != e {
+			fmt.Println(e)
+			return false
+		}
+		defer backend.Close()
+
+		job, e := backend.find(id)
+		if nil != e {
+			fmt.Println("load job '"+spec+"' failed,", e)
+			return false
+		}
+		expression = job.expression
+	} else if fileExists(spec) {
+		job, e := loadJobFromFile(spec, arguments)
+		if nil != e {
+			fmt.Println("load job '"+spec+"' failed,", e)
+			return false
+		}
+		expression = job.expression
+	}
+
+	result, e := preview(expression, count)
+	if nil != e {
+		fmt.Println("parse '"+expression+"' failed,", e)
+		return false
+	}
+	fmt.Print(previewText(result))
+	return true
+}
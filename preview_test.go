@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDescribeExpression(t *testing.T) {
+	for _, test := range []struct{ spec, excepted string }{
+		{"0 30 2 * * ?", "at 02:30:00, every day"},
+		{"0 0 * * * ?", "at second 0, minute 0, every hour"},
+		{"*/10 * * * * *", "every 10 seconds"},
+		{"0 */5 * * * *", "at second 0, every 5 minutes"},
+		{"0 0 9 * * mon-fri", "at 09:00:00, on Monday through Friday"},
+		{"0 0 0 1 1 ?", "at 00:00:00, on day 1 of the month, in January"},
+		{"0 0 0 1,15 * ?", "at 00:00:00, on days 1, 15 of the month"},
+		{"@daily", "at 00:00:00, every day"},
+		{"@every 90m", "every 1h30m0s"},
+	} {
+		if actual := describeExpression(test.spec); test.excepted != actual {
+			t.Error("'"+test.spec+"' excepted is '"+test.excepted+"', actual is", actual)
+		}
+	}
+}
+
+func TestPreview(t *testing.T) {
+	result, e := preview("0 30 2 * * ?", 3)
+	if nil != e {
+		t.Error(e)
+		return
+	}
+
+	next := result["next"].([]time.Time)
+	if 3 != len(next) {
+		t.Error("len of next is error, ", len(next))
+		return
+	}
+	for idx, tm := range next {
+		if 2 != tm.Hour() || 30 != tm.Minute() || 0 != tm.Second() {
+			t.Error(idx, tm)
+		}
+		if 0 != idx && !tm.After(next[idx-1]) {
+			t.Error(idx, tm, next[idx-1])
+		}
+	}
+
+	if _, e = preview("abc", 3); nil == e {
+		t.Error("parse 'abc' should failed.")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+)
+
+// RunResult is the result of the process of a run.
+type RunResult struct {
+	ExitCode   int
+	Signal     string
+	Duration   time.Duration
+	UserTime   time.Duration
+	SystemTime time.Duration
+	MaxRSS     int64 // bytes
+	IsTimeout  bool
+}
+
+func newRunResult(state *os.ProcessState, duration time.Duration) RunResult {
+	result := RunResult{ExitCode: exitCode(state), Duration: duration}
+	if nil == state {
+		return result
+	}
+	result.Signal = exitSignal(state)
+	result.UserTime = state.UserTime()
+	result.SystemTime = state.SystemTime()
+	result.MaxRSS = maxRSS(state)
+	return result
+}
+
+func (self *RunResult) toMap() map[string]interface{} {
+	return map[string]interface{}{"exit_code": self.ExitCode,
+		"signal":      self.Signal,
+		"duration":    self.Duration.Seconds(),
+		"user_time":   self.UserTime.Seconds(),
+		"system_time": self.SystemTime.Seconds(),
+		"max_rss":     self.MaxRSS,
+		"is_timeout":  self.IsTimeout}
+}
+
+func exitCode(state *os.ProcessState) int {
+	if nil == state {
+		return -1
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok {
+		return status.ExitStatus()
+	}
+	if state.Success() {
+		return 0
+	}
+	return -1
+}
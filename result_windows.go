@@ -0,0 +1,15 @@
+package main
+
+import (
+	"os"
+)
+
+func exitSignal(state *os.ProcessState) string {
+	return ""
+}
+
+// maxRSS isn't supported on windows, the peak working set isn't in the
+// ProcessState.
+func maxRSS(state *os.ProcessState) int64 {
+	return 0
+}
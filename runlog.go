@@ -0,0 +1,87 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const runLogLayout = "20060102_150405.000000"
+
+// runLogDirectory returns the directory of the per-run log files of the job,
+// it is job_<name> in the log path.
+func (self *ShellJob) runLogDirectory() string {
+	return strings.TrimSuffix(self.logfile, filepath.Ext(self.logfile))
+}
+
+// openLogFile returns the log file of the run that is began at begin_at, it
+// is the shared log file, or job_<name>/<timestamp>.log if per_run_log is
+// enabled.
+func (self *ShellJob) openLogFile(begin_at time.Time) (string, error) {
+	logfile := self.logfile
+	if self.per_run_log {
+		dir := self.runLogDirectory()
+		logfile = filepath.Join(dir, begin_at.Format(runLogLayout)+".log")
+		if e := os.MkdirAll(dir, 0777); nil != e {
+			return logfile, e
+		}
+	}
+
+	self.lock.Lock()
+	self.last_log_file = logfile
+	self.lock.Unlock()
+	return logfile, nil
+}
+
+// currentLogFile returns the log file that the job is writing.
+func (self *ShellJob) currentLogFile() string {
+	self.lock.Lock()
+	defer self.lock.Unlock()
+	if self.per_run_log && "" != self.last_log_file {
+		return self.last_log_file
+	}
+	return self.logfile
+}
+
+// removeRunLogs removes the per-run log files that are out of the retention,
+// at most log_retention_count files are kept and the files that are older
+// than log_retention_age are removed, it is unlimited if the value is 0.
+func (self *ShellJob) removeRunLogs() error {
+	if 0 >= self.log_retention_count && 0 >= self.log_retention_age {
+		return nil
+	}
+
+	matches, e := filepath.Glob(filepath.Join(self.runLogDirectory(), "*.log"))
+	if nil != e {
+		return e
+	}
+	files := make([]string, 0, len(matches))
+	for _, file := range matches {
+		if !strings.HasSuffix(file, ".err.log") {
+			files = append(files, file)
+		}
+	}
+	// the names are the begin times of the runs, the newest is the first.
+	sort.Sort(sort.Reverse(sort.StringSlice(files)))
+
+	now := time.Now()
+	for idx, file := range files {
+		// the new run is started after it, so one place is reserved.
+		is_expired := 0 < self.log_retention_count && idx+1 >= self.log_retention_count
+		if !is_expired && 0 < self.log_retention_age {
+			st, e := os.Stat(file)
+			is_expired = nil == e && now.Sub(st.ModTime()) > self.log_retention_age
+		}
+		if !is_expired {
+			continue
+		}
+		for _, name := range []string{file, errLogFile(file)} {
+			if e := os.Remove(name); nil != e && !os.IsNotExist(e) {
+				return e
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"github.com/runner-mei/cron"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// is_stopping is set while the daemon is shutdown, the downstream jobs aren't
+// triggered any more.
+var is_stopping int32
+
+func isStopping() bool {
+	return 0 != atomic.LoadInt32(&is_stopping)
+}
+
+var shutdown_timeout = flag.Duration("shutdown_timeout", 0, "the grace period for the running jobs while the daemon is shutdown, it is 1m if it is 0")
+
+func runningJobs(cr *cron.Cron) []*ShellJob {
+	var jobs []*ShellJob
+	for _, ent := range cr.Entries() {
+		if job, _ := toShellJob(ent.Job); nil != job && job.isRunning() {
+			jobs = append(jobs, job)
+		}
+	}
+	return jobs
+}
+
+// waitJobs waits until all jobs are finished, it returns the running jobs if
+// it is timeout.
+func waitJobs(jobs []*ShellJob, timeout time.Duration) []*ShellJob {
+	deadline := time.Now().Add(timeout)
+	for {
+		running := jobs[:0]
+		for _, job := range jobs {
+			if job.isRunning() {
+				running = append(running, job)
+			}
+		}
+		jobs = running
+
+		if 0 == len(jobs) || time.Now().After(deadline) {
+			return jobs
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// shutdown stops the schedule, waits for the running jobs in the grace period,
+// and then kills the remaining jobs, they are recorded as interrupted.
+func shutdown(cr *cron.Cron, timeout time.Duration) {
+	atomic.StoreInt32(&is_stopping, 1)
+	cr.Stop()
+
+	jobs := runningJobs(cr)
+	if 0 == len(jobs) {
+		return
+	}
+	log.Println("[sys] wait", len(jobs), "running jobs for", timeout)
+
+	jobs = waitJobs(jobs, timeout)
+	if 0 == len(jobs) {
+		return
+	}
+
+	// the jobs are interrupted at the same time, so that the grace periods
+	// of killing them are overlapped.
+	var wait sync.WaitGroup
+	for _, job := range jobs {
+		wait.Add(1)
+		go func(job *ShellJob) {
+			defer wait.Done()
+			if e := job.interrupt(); nil != e {
+				log.Println("["+job.name+"] interrupt failed,", e)
+			}
+		}(job)
+	}
+	wait.Wait()
+
+	// wait for the run history of the interrupted jobs is saved.
+	jobs = waitJobs(jobs, 10*time.Second)
+	for _, job := range jobs {
+		log.Println("[" + job.name + "] is still running after it is interrupted.")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"github.com/runner-mei/cron"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShutdown(t *testing.T) {
+	shellJobTest(t, func(dir string, job *ShellJob) {
+		job.arguments = []string{"-c", "sleep 5"}
+
+		sch, e := Parse("0 0 0 * * ?")
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		cr := cron.New()
+		cr.Schedule("abc", sch, job)
+		cr.Start()
+
+		job.Run()
+		time.Sleep(100 * time.Millisecond)
+
+		started_at := time.Now()
+		shutdown(cr, 200*time.Millisecond)
+		defer func() {
+			is_stopping = 0
+		}()
+		if time.Now().Sub(started_at) > 3*time.Second {
+			t.Error("shutdown is timeout, ", time.Now().Sub(started_at))
+		}
+		if job.isRunning() {
+			t.Error("job is still running.")
+		}
+
+		bs, e := ioutil.ReadFile(job.logfile)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if !strings.Contains(string(bs), "run "+RUN_INTERRUPTED) {
+			t.Error("run is not interrupted, ", string(bs))
+		}
+	})
+}
+
+func TestShutdownInParallel(t *testing.T) {
+	shellJobTest(t, func(dir string, job *ShellJob) {
+		old_grace := *kill_grace
+		*kill_grace = 1 * time.Second
+		defer func() {
+			*kill_grace = old_grace
+		}()
+
+		sch, _ := Parse("0 0 0 * * ?")
+		cr := cron.New()
+		var jobs []*ShellJob
+		for _, name := range []string{"a", "b", "c", "d"} {
+			j := &ShellJob{name: name,
+				execute:   job.execute,
+				arguments: []string{"-c", "trap '' TERM; sleep 5"},
+				timeout:   job.timeout,
+				logfile:   dir + "/job_" + name + ".log"}
+			cr.Schedule(name, sch, j)
+			jobs = append(jobs, j)
+		}
+		cr.Start()
+		for _, j := range jobs {
+			j.Run()
+		}
+		time.Sleep(200 * time.Millisecond)
+
+		started_at := time.Now()
+		shutdown(cr, 100*time.Millisecond)
+		defer func() {
+			is_stopping = 0
+		}()
+		if elapsed := time.Now().Sub(started_at); elapsed > 2500*time.Millisecond {
+			t.Error("the jobs aren't interrupted in parallel, ", elapsed)
+		}
+		for _, j := range jobs {
+			if j.isRunning() {
+				t.Error(j.name, "is still running.")
+			}
+		}
+	})
+}
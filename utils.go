@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
 	"time"
@@ -36,28 +38,75 @@ func intWithDefault(args map[string]interface{}, key string, defaultValue int) i
 	if !ok {
 		return defaultValue
 	}
+	if i, ok := toInt(v); ok {
+		return i
+	}
+	return defaultValue
+}
+
+// toInt converts the value to a int, the numbers are float64 or json.Number
+// while they are unmarshaled from the json.
+func toInt(v interface{}) (int, bool) {
 	switch value := v.(type) {
 	case int:
-		return value
+		return value, true
 	case int64:
-		return int(value)
+		return int(value), true
 	case int32:
-		return int(value)
+		return int(value), true
+	case float64:
+		if value != math.Trunc(value) {
+			return 0, false
+		}
+		return int(value), true
+	case float32:
+		return toInt(float64(value))
+	case json.Number:
+		if i, e := value.Int64(); nil == e {
+			return int(i), true
+		}
+		if f, e := value.Float64(); nil == e {
+			return toInt(f)
+		}
+		return 0, false
 	case string:
-		i, e := strconv.ParseInt(value, 10, 0)
+		i, e := strconv.ParseInt(strings.TrimSpace(value), 10, 0)
 		if nil != e {
-			return defaultValue
+			return 0, false
 		}
-		return int(i)
+		return int(i), true
 	default:
-		s := fmt.Sprint(value)
-		i, e := strconv.ParseInt(s, 10, 0)
+		i, e := strconv.ParseInt(fmt.Sprint(value), 10, 0)
+		if nil != e {
+			return 0, false
+		}
+		return int(i), true
+	}
+}
+
+func floatWithDefault(args map[string]interface{}, key string, defaultValue float64) float64 {
+	v, ok := args[key]
+	if !ok {
+		return defaultValue
+	}
+	switch value := v.(type) {
+	case float64:
+		return value
+	case float32:
+		return float64(value)
+	case int:
+		return float64(value)
+	case int64:
+		return float64(value)
+	default:
+		f, e := strconv.ParseFloat(fmt.Sprint(value), 64)
 		if nil != e {
 			return defaultValue
 		}
-		return int(i)
+		return f
 	}
 }
+
 func durationWithDefault(args map[string]interface{}, key string, defaultValue time.Duration) time.Duration {
 	v, ok := args[key]
 	if !ok {
@@ -183,6 +232,19 @@ func boolWithArguments(arguments []map[string]interface{}, key string, defaultVa
 }
 
 func intWithArguments(arguments []map[string]interface{}, key string, defaultValue int) int {
+	for _, arg := range arguments {
+		v, ok := arg[key]
+		if !ok {
+			continue
+		}
+		if i, ok := toInt(v); ok {
+			return i
+		}
+	}
+	return defaultValue
+}
+
+func floatWithArguments(arguments []map[string]interface{}, key string, defaultValue float64) float64 {
 	for _, arg := range arguments {
 		v, ok := arg[key]
 		if !ok {
@@ -190,22 +252,18 @@ func intWithArguments(arguments []map[string]interface{}, key string, defaultVal
 		}
 
 		switch value := v.(type) {
-		case int:
+		case float64:
 			return value
+		case float32:
+			return float64(value)
+		case int:
+			return float64(value)
 		case int64:
-			return int(value)
-		case int32:
-			return int(value)
-		case string:
-			i, e := strconv.ParseInt(value, 10, 0)
-			if nil == e {
-				return int(i)
-			}
+			return float64(value)
 		default:
-			s := fmt.Sprint(value)
-			i, e := strconv.ParseInt(s, 10, 0)
+			f, e := strconv.ParseFloat(fmt.Sprint(value), 64)
 			if nil == e {
-				return int(i)
+				return f
 			}
 		}
 	}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestIntOfJSON(t *testing.T) {
+	text := `{"log_max_bytes": 10485760, "log_max_num": 7.0, "priority": "3", "concurrency_limit": 1.5}`
+
+	var values map[string]interface{}
+	if e := json.Unmarshal([]byte(text), &values); nil != e {
+		t.Error(e)
+		return
+	}
+	var numbers map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	if e := decoder.Decode(&numbers); nil != e {
+		t.Error(e)
+		return
+	}
+
+	for _, args := range []map[string]interface{}{values, numbers} {
+		if i := intWithDefault(args, "log_max_bytes", 0); 10485760 != i {
+			t.Error("log_max_bytes is error, ", i)
+		}
+		if i := intWithArguments([]map[string]interface{}{args}, "log_max_bytes", 0); 10485760 != i {
+			t.Error("log_max_bytes is error, ", i)
+		}
+		if i := intWithArguments([]map[string]interface{}{args}, "log_max_num", 0); 7 != i {
+			t.Error("log_max_num is error, ", i)
+		}
+		if i := intWithDefault(args, "priority", 0); 3 != i {
+			t.Error("priority is error, ", i)
+		}
+		if i := intWithDefault(args, "concurrency_limit", -1); -1 != i {
+			t.Error("the fraction is accepted, ", i)
+		}
+	}
+
+	job, e := loadJobFromMap("abc.json", []map[string]interface{}{{"expression": "@every 1h", "execute": "/bin/sh", "log_max_bytes": values["log_max_bytes"]}})
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if 10485760 != job.log_max_bytes {
+		t.Error("log_max_bytes of the job file is error, ", job.log_max_bytes)
+	}
+}
@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type fieldError struct {
+	field   string
+	message string
+}
+
+func (self fieldError) Error() string {
+	return "'" + self.field + "' " + self.message
+}
+
+// validationErrors is all the problems of a job definition.
+type validationErrors []fieldError
+
+func (self *validationErrors) add(field, message string) {
+	*self = append(*self, fieldError{field: field, message: message})
+}
+
+func (self validationErrors) has(field string) bool {
+	for _, e := range self {
+		if field == e.field {
+			return true
+		}
+	}
+	return false
+}
+
+func (self validationErrors) Error() string {
+	var buffer bytes.Buffer
+	for idx, e := range self {
+		if 0 != idx {
+			buffer.WriteString("\r\n")
+		}
+		buffer.WriteString(e.Error())
+	}
+	return buffer.String()
+}
+
+func (self validationErrors) toMaps() []map[string]string {
+	results := make([]map[string]string, 0, len(self))
+	for _, e := range self {
+		results = append(results, map[string]string{"field": e.field, "message": e.message})
+	}
+	return results
+}
+
+func toValidationErrors(field string, e error) validationErrors {
+	if errs, ok := e.(validationErrors); ok {
+		return errs
+	}
+	return validationErrors{{field: field, message: e.Error()}}
+}
+
+func validateSchedule(errs *validationErrors, job *ShellJob) {
+	if "" == job.name {
+		errs.add("name", "is missing.")
+	}
+	if "" == job.expression {
+		if 0 == len(job.depends_on) {
+			errs.add("expression", "is missing, it is required if depends_on is empty.")
+		}
+	} else if _, e := Parse(job.expression); nil != e {
+		errs.add("expression", "is invalid, "+e.Error())
+	}
+	if job.timeout <= 0*time.Second {
+		errs.add("timeout", "must is greate 0s.")
+	}
+	if job.max_retries < 0 {
+		errs.add("max_retries", "must is greate(or equals) 0.")
+	}
+	if job.retry_delay < 0*time.Second {
+		errs.add("retry_delay", "must is greate(or equals) 0s.")
+	}
+	if job.retry_backoff < 1 {
+		errs.add("retry_backoff", "must is greate(or equals) 1.")
+	}
+	switch job.concurrency {
+	case "", CONCURRENCY_FORBID, CONCURRENCY_ALLOW, CONCURRENCY_REPLACE, CONCURRENCY_QUEUE:
+	default:
+		errs.add("concurrency", "'"+job.concurrency+"' is unsupported, it must is one of forbid, allow, replace and queue.")
+	}
+	if job.concurrency_limit < 0 {
+		errs.add("concurrency_limit", "must is greate(or equals) 0.")
+	}
+	switch job.output {
+	case "", OUTPUT_MERGED, OUTPUT_SEPARATE, OUTPUT_TAGGED:
+	default:
+		errs.add("output", "'"+job.output+"' is unsupported, it must is one of merged, separate and tagged.")
+	}
+}
+
+func validateCommand(errs *validationErrors, job *ShellJob) {
+	if "" != job.directory && !dirExists(job.directory) {
+		errs.add("directory", "'"+job.directory+"' is not exists.")
+	}
+
+	if "" == job.execute {
+		errs.add("execute", "is missing.")
+		return
+	}
+	execute := job.execute
+	if "" != job.directory && !filepath.IsAbs(execute) && strings.ContainsAny(execute, "/\\") {
+		execute = filepath.Join(job.directory, execute)
+	}
+	if _, e := exec.LookPath(execute); nil != e {
+		errs.add("execute", "'"+job.execute+"' is not executable, "+e.Error())
+	}
+}
+
+// validateJob checks a loaded job, the templates of it must be rendered.
+func validateJob(job *ShellJob) validationErrors {
+	var errs validationErrors
+	validateSchedule(&errs, job)
+	if nil == job.workflow {
+		validateCommand(&errs, job)
+		return errs
+	}
+	for _, step := range job.workflow.steps {
+		var step_errs validationErrors
+		validateCommand(&step_errs, step.job)
+		for _, e := range step_errs {
+			errs.add("steps."+step.name+"."+e.field, e.message)
+		}
+	}
+	return errs
+}
+
+func validateJobFile(file string, arguments map[string]interface{}) validationErrors {
+	value, e := readJobFile(file, arguments)
+	if nil != e {
+		return validationErrors{{field: "file", message: e.Error()}}
+	}
+
+	var errs validationErrors
+	for _, field := range []string{"timeout", "retry_delay", "log_retention_age"} {
+		if v, ok := value[field]; ok {
+			if _, e := time.ParseDuration(fmt.Sprint(v)); nil != e {
+				errs.add(field, "'"+fmt.Sprint(v)+"' is not a duration.")
+			}
+		}
+	}
+
+	args := []map[string]interface{}{value, arguments}
+	job, e := loadJobFromMap(file, args)
+	if nil == e {
+		return append(errs, validateJob(job)...)
+	}
+
+	// the job isn't loaded, the fields that aren't reported by loadJobFromMap
+	// are checked on the raw values, so that all the problems are reported at
+	// once.
+	errs = append(errs, toValidationErrors("file", e)...)
+	for _, fe := range validateRawJob(file, args) {
+		if !errs.has(fe.field) {
+			errs = append(errs, fe)
+		}
+	}
+	return errs
+}
+
+// validateRawJob checks the job that is failed to load by loadJobFromMap.
+func validateRawJob(file string, args []map[string]interface{}) validationErrors {
+	job := &ShellJob{name: strings.ToLower(filepath.Base(file)),
+		expression:        stringWithArguments(args, "expression", ""),
+		execute:           stringWithArguments(args, "execute", ""),
+		directory:         stringWithDefault(args[0], "directory", ""),
+		timeout:           durationWithArguments(args, "timeout", 10*time.Minute),
+		max_retries:       intWithArguments(args, "max_retries", 0),
+		retry_delay:       durationWithArguments(args, "retry_delay", defaultRetryDelay),
+		retry_backoff:     floatWithArguments(args, "retry_backoff", defaultRetryBackoff),
+		concurrency:       strings.ToLower(stringWithArguments(args, "concurrency", CONCURRENCY_FORBID)),
+		concurrency_limit: intWithArguments(args, "concurrency_limit", 0),
+		output:            strings.ToLower(stringWithArguments(args, "output", OUTPUT_MERGED)),
+		depends_on:        stringsWithArguments(args, "depends_on", ",", nil, false)}
+
+	if "" == job.directory && 1 < len(args) {
+		job.directory = stringWithArguments(args[1:], "root_dir", "")
+	}
+
+	var errs validationErrors
+	validateSchedule(&errs, job)
+	if JOB_WORKFLOW != stringWithDefault(args[0], "type", "") {
+		validateCommand(&errs, job)
+	}
+	return errs
+}
+
+func renderTemplate(errs *validationErrors, field, s string, arguments map[string]interface{}) (result string) {
+	defer func() {
+		if o := recover(); nil != o {
+			errs.add(field, "render template failed, "+fmt.Sprint(o))
+			result = s
+		}
+	}()
+	return executeTemplate(s, arguments)
+}
+
+// validateDBJob checks a row of the db before afterLoad is called, a copy of
+// the job is loaded by afterLoad and the job isn't changed.
+func validateDBJob(job *JobFromDB, arguments map[string]interface{}) validationErrors {
+	var errs validationErrors
+	resolved := &JobFromDB{}
+	resolved.id = job.id
+	resolved.name = job.name
+	resolved.expression = job.expression
+	resolved.timeout = job.timeout
+	resolved.max_retries = job.max_retries
+	resolved.retry_delay = job.retry_delay
+	resolved.retry_backoff = job.retry_backoff
+	resolved.concurrency = job.concurrency
+	resolved.concurrency_limit = job.concurrency_limit
+	resolved.priority = job.priority
+	resolved.notify_to = job.notify_to
+	resolved.webhooks = job.webhooks
+	resolved.depends_on = job.depends_on
+	resolved.on_success = job.on_success
+	resolved.on_failure = job.on_failure
+	resolved.log_options = job.log_options
+	resolved.execute = job.execute
+	resolved.directory = job.directory
+	resolved.arguments = append([]string(nil), job.arguments...)
+	resolved.environments = append([]string(nil), job.environments...)
+
+	validateSchedule(&errs, &resolved.ShellJob)
+	// the timeout is saved in seconds.
+	if 0 < job.timeout && job.timeout < 1*time.Second {
+		errs.add("timeout", "must is greate(or equals) 1s.")
+	}
+
+	o, e := tryAfterLoad(resolved, arguments)
+	if nil != o {
+		// a template is failed, render the fields one by one to find out it.
+		var template_errs validationErrors
+		renderTemplate(&template_errs, "execute", job.execute, arguments)
+		renderTemplate(&template_errs, "directory", job.directory, arguments)
+		for _, s := range job.arguments {
+			renderTemplate(&template_errs, "arguments", s, arguments)
+		}
+		for _, s := range job.environments {
+			renderTemplate(&template_errs, "environments", s, arguments)
+		}
+		if 0 == len(template_errs) {
+			template_errs.add("arguments", "load failed, "+fmt.Sprint(o))
+		}
+		return append(errs, template_errs...)
+	}
+	if nil != e {
+		errs.add("arguments", e.Error())
+		return errs
+	}
+	validateCommand(&errs, &resolved.ShellJob)
+	return errs
+}
+
+// tryAfterLoad calls afterLoad, the panic of it(a template is failed) is
+// returned.
+func tryAfterLoad(job *JobFromDB, arguments map[string]interface{}) (o interface{}, e error) {
+	defer func() {
+		o = recover()
+	}()
+	return nil, afterLoad(job, arguments)
+}
+
+// runValidate validates the job files or the ids of the db jobs in names, all
+// jobs are validated if names is empty. It returns false if any job is invalid.
+func runValidate(names []string, job_directories []string, arguments map[string]interface{}) bool {
+	var backend *dbBackend
+	openBackend := func() (*dbBackend, error) {
+		if nil != backend {
+			return backend, nil
+		}
+		var e error
+		backend, e = newBackend(*db_drv, *db_url)
+		return backend, e
+	}
+	defer func() {
+		if nil != backend {
+			backend.Close()
+		}
+	}()
+
+	is_ok := true
+	report := func(name string, errs validationErrors) {
+		if 0 == len(errs) {
+			fmt.Println("[" + name + "] ok")
+			return
+		}
+		is_ok = false
+		for _, e := range errs {
+			fmt.Println("["+name+"]", e.field+":", e.message)
+		}
+	}
+
+	if 0 == len(names) {
+		for _, dir := range job_directories {
+			matches, e := filepath.Glob(filepath.Join(dir, "*.*"))
+			if nil != e {
+				report(dir, validationErrors{{field: "file", message: e.Error()}})
+				continue
+			}
+			names = append(names, matches...)
+		}
+
+		db, e := openBackend()
+		if nil == e {
+			var jobs []*JobFromDB
+			jobs, e = db.where(nil)
+			for _, job := range jobs {
+				report(fmt.Sprint(job.id)+"("+job.name+")", validateDBJob(job, arguments))
+			}
+		}
+		if nil != e {
+			report("db", validationErrors{{field: "db", message: e.Error()}})
+		}
+	}
+
+	for _, name := range names {
+		id, e := strconv.ParseInt(name, 10, 64)
+		if nil != e {
+			report(name, validateJobFile(name, arguments))
+			continue
+		}
+
+		db, e := openBackend()
+		if nil != e {
+			report(name, validationErrors{{field: "db", message: e.Error()}})
+			continue
+		}
+		job, e := db.find(id)
+		if nil != e {
+			report(name, validationErrors{{field: "id", message: e.Error()}})
+			continue
+		}
+		report(name+"("+job.name+")", validateDBJob(job, arguments))
+	}
+	return is_ok
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func hasField(errs validationErrors, field string) bool {
+	return errs.has(field)
+}
+
+func TestValidateJobFile(t *testing.T) {
+	dir, e := ioutil.TempDir("", "sched_validate")
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "abc.json")
+	e = ioutil.WriteFile(file, []byte(`{"expression": "abc", "execute": "not_exists_execute", "directory": "{{.root_dir}}/not_exists", "timeout": "10x"}`), 0666)
+	if nil != e {
+		t.Error(e)
+		return
+	}
+
+	errs := validateJobFile(file, map[string]interface{}{"root_dir": dir})
+	for _, field := range []string{"expression", "execute", "directory", "timeout"} {
+		if !hasField(errs, field) {
+			t.Error("'"+field+"' is not reported,", errs)
+		}
+	}
+
+	// the other fields are reported even if the job isn't loaded.
+	e = ioutil.WriteFile(file, []byte(`{"execute": "not_exists_execute", "directory": "{{.root_dir}}/not_exists", "concurrency": "abc"}`), 0666)
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	errs = validateJobFile(file, map[string]interface{}{"root_dir": dir})
+	for _, field := range []string{"expression", "execute", "directory", "concurrency"} {
+		if !hasField(errs, field) {
+			t.Error("'"+field+"' is not reported,", errs)
+		}
+	}
+
+	e = ioutil.WriteFile(file, []byte(`{"expression": "0 0 * * * ?", "execute": "{{.execute}}", "directory": "{{.root_dir}}"}`), 0666)
+	if nil != e {
+		t.Error(e)
+		return
+	}
+
+	execute, e := os.Executable()
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	errs = validateJobFile(file, map[string]interface{}{"root_dir": dir, "execute": execute})
+	if 0 != len(errs) {
+		t.Error(errs)
+	}
+}
+
+func TestValidateDBJob(t *testing.T) {
+	job := &JobFromDB{}
+	job.name = "abc"
+	job.expression = "0 0 * * * ?"
+	job.execute = "{{.a1"
+	job.arguments = []string{"{{.a2}}", "{{end}}"}
+	job.timeout = -1 * time.Second
+
+	errs := validateDBJob(job, map[string]interface{}{"a2": "b2"})
+	for _, field := range []string{"execute", "arguments", "timeout"} {
+		if !hasField(errs, field) {
+			t.Error("'"+field+"' is not reported,", errs)
+		}
+	}
+	if hasField(errs, "expression") || hasField(errs, "name") {
+		t.Error(errs)
+	}
+	if "{{.a1" != job.execute || "{{.a2}}" != job.arguments[0] {
+		t.Error("job is changed,", job.execute, job.arguments)
+	}
+	job.timeout = 500 * time.Millisecond
+	if errs = validateDBJob(job, map[string]interface{}{"a2": "b2"}); !hasField(errs, "timeout") {
+		t.Error("the timeout that is less than 1s is not reported,", errs)
+	}
+
+	// the templates are rendered once, the value of the argument isn't a
+	// template.
+	job.timeout = time.Minute
+	job.retry_backoff = defaultRetryBackoff
+	job.execute = "/bin/sh"
+	job.arguments = []string{"-c", "{{.a3}}"}
+	if errs = validateDBJob(job, map[string]interface{}{"a3": "echo {{end}}"}); 0 != len(errs) {
+		t.Error("the templates are rendered twice,", errs)
+	}
+}
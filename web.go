@@ -0,0 +1,522 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"github.com/runner-mei/cron"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// webServer serves the json api of jobs, it is mounted at '/jobs'.
+//
+//	GET  /jobs            list all jobs
+//	GET  /jobs/{id}       inspect a job
+//	GET  /jobs/{id}/log   read the log file of a job, see log() for the options
+//	POST /jobs/{id}/run   run a job immediately, bypassing the schedule
+//	POST /jobs/{id}/kill  kill the running process of a job
+//
+// the jobs in the db are changed by the following api, the changes are
+// scheduled while the db is polled at next time. The api isn't authenticated,
+// so it is disabled unless web_edit is enabled.
+//
+//	POST   /jobs          create a job in the db
+//	PUT    /jobs/{id}     update a job in the db
+//	DELETE /jobs/{id}     delete a job from the db
+//	POST   /jobs/validate validate a job without saving it
+//
+// the next activation times of a job or an expression are previewed by
+//
+//	GET /jobs/{id}/next?count=10
+//	GET /preview?expression=0+0+*+*+*+?&count=10
+type webServer struct {
+	cr          *cron.Cron
+	error_jobs  *errorJobs
+	backend     *dbBackend
+	arguments   map[string]interface{}
+	is_editable bool
+}
+
+var web_edit = flag.Bool("web_edit", false, "enable creating, updating and deleting the jobs of the db by the http api, the api isn't authenticated")
+
+func renderJSON(w http.ResponseWriter, code int, value interface{}) {
+	bs, e := json.MarshalIndent(value, "", "  ")
+	if nil != e {
+		renderError(w, http.StatusInternalServerError, e.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write(bs)
+}
+
+func renderError(w http.ResponseWriter, code int, message string) {
+	bs, _ := json.Marshal(map[string]interface{}{"error": message})
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	w.Write(bs)
+}
+
+func toShellJob(job cron.Job) (*ShellJob, string) {
+	switch v := job.(type) {
+	case *ShellJob:
+		return v, "file"
+	case *JobFromDB:
+		return &v.ShellJob, "db"
+	}
+	return nil, ""
+}
+
+func jobInfo(ent *cron.Entry) map[string]interface{} {
+	info := map[string]interface{}{"id": ent.Id,
+		"next": ent.Next,
+		"prev": ent.Prev}
+
+	job, source := toShellJob(ent.Job)
+	if nil == job {
+		return info
+	}
+	info["source"] = source
+	info["stats"] = job.Stats()
+	return fillJobInfo(info, job)
+}
+
+func fillJobInfo(info map[string]interface{}, job *ShellJob) map[string]interface{} {
+	info["name"] = job.name
+	info["expression"] = job.expression
+	info["execute"] = job.execute
+	info["directory"] = job.directory
+	info["arguments"] = job.arguments
+	info["environments"] = job.environments
+	info["timeout"] = job.timeout.String()
+	info["max_retries"] = job.max_retries
+	info["retry_delay"] = job.retry_delay.String()
+	info["retry_backoff"] = job.retry_backoff
+	info["concurrency"] = job.concurrency
+	info["concurrency_limit"] = job.concurrency_limit
+	info["priority"] = job.priority
+	info["waiting"] = atomic.LoadInt32(&job.waiting)
+	info["logfile"] = job.logfile
+	info["output"] = job.output
+	info["notify_to"] = job.notify_to
+	info["webhooks"] = job.webhooks
+	info["depends_on"] = job.depends_on
+	info["on_success"] = job.on_success
+	info["on_failure"] = job.on_failure
+	if nil != job.workflow {
+		steps := make([]map[string]interface{}, 0, len(job.workflow.steps))
+		for _, step := range job.workflow.steps {
+			steps = append(steps, map[string]interface{}{"name": step.name,
+				"depends_on": step.depends_on,
+				"execute":    step.job.execute,
+				"arguments":  step.job.arguments,
+				"timeout":    step.job.timeout.String(),
+				"logfile":    step.job.logfile})
+		}
+		info["type"] = JOB_WORKFLOW
+		info["steps"] = steps
+	}
+	info["running"] = job.isRunning()
+	return info
+}
+
+func (self *webServer) entry(id string) *cron.Entry {
+	for _, ent := range self.cr.Entries() {
+		if id == ent.Id {
+			return ent
+		}
+	}
+	return nil
+}
+
+func (self *webServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	paths := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs"), "/"), "/")
+	if 1 == len(paths) && "" == paths[0] {
+		paths = nil
+	}
+
+	switch len(paths) {
+	case 0:
+		switch r.Method {
+		case "GET":
+			self.list(w, r)
+			return
+		case "POST":
+			if self.checkEditable(w) {
+				self.create(w, r)
+			}
+			return
+		}
+	case 1:
+		switch r.Method {
+		case "GET":
+			self.get(w, r, paths[0])
+			return
+		case "POST":
+			if "validate" == paths[0] {
+				self.validate(w, r)
+				return
+			}
+		case "PUT":
+			if self.checkEditable(w) {
+				self.update(w, r, paths[0])
+			}
+			return
+		case "DELETE":
+			if self.checkEditable(w) {
+				self.delete(w, r, paths[0])
+			}
+			return
+		}
+	case 2:
+		if "GET" == r.Method {
+			switch paths[1] {
+			case "next":
+				self.next(w, r, paths[0])
+				return
+			case "log":
+				self.log(w, r, paths[0])
+				return
+			}
+		}
+		if "POST" == r.Method {
+			switch paths[1] {
+			case "run":
+				self.run(w, r, paths[0])
+				return
+			case "kill":
+				self.kill(w, r, paths[0])
+				return
+			}
+		}
+	}
+	renderError(w, http.StatusNotFound, "'"+r.Method+" "+r.URL.Path+"' is not found.")
+}
+
+// checkEditable renders a error if the jobs of the db can't be changed by
+// the api.
+func (self *webServer) checkEditable(w http.ResponseWriter) bool {
+	if !self.is_editable {
+		renderError(w, http.StatusForbidden, "changing the jobs is disabled, it is enabled by the option 'web_edit'.")
+		return false
+	}
+	return true
+}
+
+// chainInfo adds the upstream and the downstream jobs of the job into info.
+func chainInfo(jobs map[string]*ShellJob, info map[string]interface{}, ent *cron.Entry) map[string]interface{} {
+	if job, _ := toShellJob(ent.Job); nil != job {
+		info["upstream"] = upstreamJobs(jobs, ent.Id)
+		info["downstream"] = downstreamJobs(jobs, job, "")
+	}
+	return info
+}
+
+func (self *webServer) list(w http.ResponseWriter, r *http.Request) {
+	scheduled := scheduledJobs(self.cr)
+	jobs := make([]interface{}, 0, 10)
+	for _, ent := range self.cr.Entries() {
+		jobs = append(jobs, chainInfo(scheduled, jobInfo(ent), ent))
+	}
+
+	load_errors := map[string]string{}
+	for id, e := range self.error_jobs.snapshot() {
+		load_errors[id] = e.Error()
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{"jobs": jobs, "errors": load_errors})
+}
+
+func (self *webServer) get(w http.ResponseWriter, r *http.Request, id string) {
+	if ent := self.entry(id); nil != ent {
+		renderJSON(w, http.StatusOK, chainInfo(scheduledJobs(self.cr), jobInfo(ent), ent))
+		return
+	}
+	if e, ok := self.error_jobs.get(id); ok {
+		renderJSON(w, http.StatusOK, map[string]interface{}{"id": id, "error": e.Error()})
+		return
+	}
+	renderError(w, http.StatusNotFound, "job '"+id+"' is not found.")
+}
+
+func (self *webServer) run(w http.ResponseWriter, r *http.Request, id string) {
+	ent := self.entry(id)
+	if nil == ent {
+		renderError(w, http.StatusNotFound, "job '"+id+"' is not found.")
+		return
+	}
+	if job, _ := toShellJob(ent.Job); nil != job && job.isRunning() &&
+		(CONCURRENCY_FORBID == job.concurrency || "" == job.concurrency) {
+		renderError(w, http.StatusConflict, "job '"+id+"' is running.")
+		return
+	}
+	ent.Job.Run()
+	renderJSON(w, http.StatusAccepted, jobInfo(ent))
+}
+
+func (self *webServer) kill(w http.ResponseWriter, r *http.Request, id string) {
+	ent := self.entry(id)
+	if nil == ent {
+		renderError(w, http.StatusNotFound, "job '"+id+"' is not found.")
+		return
+	}
+	job, _ := toShellJob(ent.Job)
+	if nil == job {
+		renderError(w, http.StatusBadRequest, "job '"+id+"' can't be killed.")
+		return
+	}
+	if e := job.Kill(); nil != e {
+		renderError(w, http.StatusConflict, e.Error())
+		return
+	}
+	renderJSON(w, http.StatusOK, jobInfo(ent))
+}
+
+func dbJobInfo(job *JobFromDB) map[string]interface{} {
+	return fillJobInfo(map[string]interface{}{"id": strconv.FormatInt(job.id, 10),
+		"source":     "db",
+		"created_at": job.created_at,
+		"updated_at": job.updated_at}, &job.ShellJob)
+}
+
+func readValues(r *http.Request) (map[string]interface{}, error) {
+	var values map[string]interface{}
+	decoder := json.NewDecoder(r.Body)
+	decoder.UseNumber()
+	if e := decoder.Decode(&values); nil != e {
+		return nil, errors.New("read body failed, " + e.Error())
+	}
+	if nil == values {
+		return nil, errors.New("read body failed, it is empty.")
+	}
+	return values, nil
+}
+
+// applyValues copies the fields that are present in values into job.
+func applyValues(job *JobFromDB, values map[string]interface{}) {
+	if _, ok := values["name"]; ok {
+		job.name = stringWithDefault(values, "name", "")
+	}
+	if _, ok := values["expression"]; ok {
+		job.expression = stringWithDefault(values, "expression", "")
+	}
+	if _, ok := values["execute"]; ok {
+		job.execute = stringWithDefault(values, "execute", "")
+	}
+	if _, ok := values["directory"]; ok {
+		job.directory = stringWithDefault(values, "directory", "")
+	}
+	if _, ok := values["arguments"]; ok {
+		job.arguments = stringsWithDefault(values, "arguments", "\n", nil)
+	}
+	if _, ok := values["environments"]; ok {
+		job.environments = stringsWithDefault(values, "environments", "\n", nil)
+	}
+	if _, ok := values["timeout"]; ok {
+		job.timeout = durationWithDefault(values, "timeout", 0)
+	}
+	if _, ok := values["max_retries"]; ok {
+		job.max_retries = intWithDefault(values, "max_retries", 0)
+	}
+	if _, ok := values["retry_delay"]; ok {
+		job.retry_delay = durationWithDefault(values, "retry_delay", defaultRetryDelay)
+	}
+	if _, ok := values["retry_backoff"]; ok {
+		job.retry_backoff = floatWithDefault(values, "retry_backoff", defaultRetryBackoff)
+	}
+	if _, ok := values["concurrency"]; ok {
+		job.concurrency = strings.ToLower(stringWithDefault(values, "concurrency", CONCURRENCY_FORBID))
+	}
+	if _, ok := values["concurrency_limit"]; ok {
+		job.concurrency_limit = intWithDefault(values, "concurrency_limit", 0)
+	}
+	if _, ok := values["priority"]; ok {
+		job.priority = intWithDefault(values, "priority", 0)
+	}
+	if _, ok := values["notify_to"]; ok {
+		job.notify_to = trimStrings(stringsWithDefault(values, "notify_to", ",", nil))
+	}
+	if _, ok := values["webhooks"]; ok {
+		job.webhooks = trimStrings(stringsWithDefault(values, "webhooks", "\n", nil))
+	}
+	for _, name := range logOptions {
+		v, ok := values[name]
+		if !ok {
+			continue
+		}
+		if nil == v {
+			delete(job.log_options, name)
+			continue
+		}
+		if nil == job.log_options {
+			job.log_options = map[string]interface{}{}
+		}
+		job.log_options[name] = v
+	}
+	for _, field := range []struct {
+		name  string
+		value *[]string
+	}{{"depends_on", &job.depends_on}, {"on_success", &job.on_success}, {"on_failure", &job.on_failure}} {
+		if _, ok := values[field.name]; ok {
+			*field.value = trimStrings(stringsWithDefault(values, field.name, ",", nil))
+		}
+	}
+}
+
+func newJobFromDB() *JobFromDB {
+	job := &JobFromDB{}
+	job.timeout = 10 * time.Minute
+	job.retry_delay = defaultRetryDelay
+	job.retry_backoff = defaultRetryBackoff
+	job.concurrency = CONCURRENCY_FORBID
+	return job
+}
+
+func parseId(w http.ResponseWriter, id string) (int64, bool) {
+	i, e := strconv.ParseInt(id, 10, 64)
+	if nil != e {
+		renderError(w, http.StatusBadRequest, "job '"+id+"' isn't a job of the db.")
+		return 0, false
+	}
+	return i, true
+}
+
+func (self *webServer) create(w http.ResponseWriter, r *http.Request) {
+	values, e := readValues(r)
+	if nil != e {
+		renderError(w, http.StatusBadRequest, e.Error())
+		return
+	}
+
+	job := newJobFromDB()
+	applyValues(job, values)
+	if errs := validateDBJob(job, self.arguments); 0 != len(errs) {
+		renderJSON(w, http.StatusBadRequest, map[string]interface{}{"error": errs.Error(), "errors": errs.toMaps()})
+		return
+	}
+
+	if _, e = self.backend.insert(job); nil != e {
+		renderError(w, http.StatusInternalServerError, e.Error())
+		return
+	}
+	renderJSON(w, http.StatusCreated, dbJobInfo(job))
+}
+
+func (self *webServer) update(w http.ResponseWriter, r *http.Request, id string) {
+	i, ok := parseId(w, id)
+	if !ok {
+		return
+	}
+	values, e := readValues(r)
+	if nil != e {
+		renderError(w, http.StatusBadRequest, e.Error())
+		return
+	}
+
+	job, e := self.backend.find(i)
+	if nil != e {
+		if sql.ErrNoRows == e {
+			renderError(w, http.StatusNotFound, "job '"+id+"' is not found.")
+		} else {
+			renderError(w, http.StatusInternalServerError, e.Error())
+		}
+		return
+	}
+
+	applyValues(job, values)
+	if errs := validateDBJob(job, self.arguments); 0 != len(errs) {
+		renderJSON(w, http.StatusBadRequest, map[string]interface{}{"error": errs.Error(), "errors": errs.toMaps()})
+		return
+	}
+
+	if e = self.backend.update(job); nil != e {
+		if sql.ErrNoRows == e {
+			renderError(w, http.StatusNotFound, "job '"+id+"' is not found.")
+		} else {
+			renderError(w, http.StatusInternalServerError, e.Error())
+		}
+		return
+	}
+	renderJSON(w, http.StatusOK, dbJobInfo(job))
+}
+
+func (self *webServer) delete(w http.ResponseWriter, r *http.Request, id string) {
+	i, ok := parseId(w, id)
+	if !ok {
+		return
+	}
+
+	if e := self.backend.delete(i); nil != e {
+		if sql.ErrNoRows == e {
+			renderError(w, http.StatusNotFound, "job '"+id+"' is not found.")
+		} else {
+			renderError(w, http.StatusInternalServerError, e.Error())
+		}
+		return
+	}
+	renderJSON(w, http.StatusOK, map[string]interface{}{"id": id, "deleted": true})
+}
+
+func (self *webServer) validate(w http.ResponseWriter, r *http.Request) {
+	values, e := readValues(r)
+	if nil != e {
+		renderError(w, http.StatusBadRequest, e.Error())
+		return
+	}
+
+	job := newJobFromDB()
+	applyValues(job, values)
+	errs := validateDBJob(job, self.arguments)
+	renderJSON(w, http.StatusOK, map[string]interface{}{"valid": 0 == len(errs), "errors": errs.toMaps()})
+}
+
+func previewCount(r *http.Request) int {
+	count := 10
+	if s := r.URL.Query().Get("count"); "" != s {
+		if i, e := strconv.Atoi(s); nil == e && i > 0 {
+			count = i
+		}
+	}
+	if count > 1000 {
+		count = 1000
+	}
+	return count
+}
+
+func (self *webServer) next(w http.ResponseWriter, r *http.Request, id string) {
+	ent := self.entry(id)
+	if nil == ent {
+		renderError(w, http.StatusNotFound, "job '"+id+"' is not found.")
+		return
+	}
+	job, _ := toShellJob(ent.Job)
+	if nil == job {
+		renderError(w, http.StatusBadRequest, "job '"+id+"' hasn't a expression.")
+		return
+	}
+	result, e := preview(job.expression, previewCount(r))
+	if nil != e {
+		renderError(w, http.StatusBadRequest, e.Error())
+		return
+	}
+	result["id"] = id
+	renderJSON(w, http.StatusOK, result)
+}
+
+func (self *webServer) preview(w http.ResponseWriter, r *http.Request) {
+	expression := r.URL.Query().Get("expression")
+	if "" == expression {
+		renderError(w, http.StatusBadRequest, "'expression' is missing.")
+		return
+	}
+	result, e := preview(expression, previewCount(r))
+	if nil != e {
+		renderError(w, http.StatusBadRequest, e.Error())
+		return
+	}
+	renderJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultTailLines = 10
+	followInterval   = 500 * time.Millisecond
+)
+
+// logFile returns the name of the log file of the generation, 0 is the
+// current file and 1 to log_max_num are the rotated files.
+func logFile(logfile string, generation int) string {
+	if 0 == generation {
+		return logfile
+	}
+	if name := rotatedFile(logfile, generation); "" != name {
+		return name
+	}
+	return logfile + fmt.Sprintf(".%04d", generation)
+}
+
+// tailOffset returns the offset of the last n lines of the file.
+func tailOffset(file *os.File, size int64, n int) (int64, error) {
+	if n <= 0 {
+		return size, nil
+	}
+
+	buf := make([]byte, 4096)
+	offset := size
+	lines := 0
+	for offset > 0 {
+		length := int64(len(buf))
+		if offset < length {
+			length = offset
+		}
+		offset -= length
+		if _, e := file.ReadAt(buf[:length], offset); nil != e && io.EOF != e {
+			return 0, e
+		}
+
+		for idx := length - 1; idx >= 0; idx-- {
+			if '\n' != buf[idx] {
+				continue
+			}
+			// the last line break of the file isn't a separator.
+			if offset+idx == size-1 {
+				continue
+			}
+			lines++
+			if lines >= n {
+				return offset + idx + 1, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// log serves the log file of a job.
+//
+//	generation=N  read the rotated file job_<name>.log.000N, 0 is the current,
+//	              the compressed file is sent as is
+//	stream=err    read the stderr file if the output is separate
+//	run=NAME      read the log file job_<name>/NAME of a run if the per-run log
+//	              files are enabled, it is the file of the last run by default
+//	tail=N        read the last N lines
+//	follow=true   keep on sending the new lines while the job is running, it
+//	              begins with the last 10 lines if tail is missing
+//
+// the byte range of the file is read by the 'Range' header.
+func (self *webServer) log(w http.ResponseWriter, r *http.Request, id string) {
+	ent := self.entry(id)
+	if nil == ent {
+		renderError(w, http.StatusNotFound, "job '"+id+"' is not found.")
+		return
+	}
+	job, _ := toShellJob(ent.Job)
+	if nil == job || "" == job.logfile {
+		renderError(w, http.StatusNotFound, "log of job '"+id+"' is not found.")
+		return
+	}
+
+	query := r.URL.Query()
+	generation := 0
+	if s := query.Get("generation"); "" != s {
+		i, e := strconv.Atoi(s)
+		if nil != e || i < 0 || i > job.maxLogNum() {
+			renderError(w, http.StatusBadRequest, "generation '"+s+"' is invalid, it must is between 0 and "+fmt.Sprint(job.maxLogNum())+".")
+			return
+		}
+		generation = i
+	}
+	tail := -1
+	if s := query.Get("tail"); "" != s {
+		i, e := strconv.Atoi(s)
+		if nil != e || i < 0 {
+			renderError(w, http.StatusBadRequest, "tail '"+s+"' is invalid.")
+			return
+		}
+		tail = i
+	}
+	follow := "true" == query.Get("follow")
+	if follow && 0 != generation {
+		renderError(w, http.StatusBadRequest, "the rotated log file can't be followed.")
+		return
+	}
+
+	current := job.currentLogFile
+	switch query.Get("stream") {
+	case "", "out":
+	case "err":
+		if OUTPUT_SEPARATE != job.output {
+			renderError(w, http.StatusBadRequest, "stderr isn't separate from the log file.")
+			return
+		}
+		current = func() string {
+			return errLogFile(job.currentLogFile())
+		}
+	default:
+		renderError(w, http.StatusBadRequest, "stream '"+query.Get("stream")+"' is invalid, it must is out or err.")
+		return
+	}
+
+	name := logFile(current(), generation)
+	if s := query.Get("run"); "" != s {
+		if !job.per_run_log || 0 != generation || follow {
+			renderError(w, http.StatusBadRequest, "run is only for the per-run log files and can't be followed.")
+			return
+		}
+		name = filepath.Join(job.runLogDirectory(), filepath.Base(s))
+		if "err" == query.Get("stream") {
+			name = errLogFile(name)
+		}
+	} else if job.per_run_log && 0 != generation {
+		renderError(w, http.StatusBadRequest, "the per-run log files haven't any generation.")
+		return
+	}
+	file, e := os.Open(name)
+	if nil != e {
+		if os.IsNotExist(e) {
+			renderError(w, http.StatusNotFound, "log file '"+name+"' is not exists.")
+		} else {
+			renderError(w, http.StatusInternalServerError, e.Error())
+		}
+		return
+	}
+	defer file.Close()
+	st, e := file.Stat()
+	if nil != e {
+		renderError(w, http.StatusInternalServerError, e.Error())
+		return
+	}
+
+	if strings.HasSuffix(name, ".gz") {
+		if tail >= 0 {
+			renderError(w, http.StatusBadRequest, "the compressed log file can't be tailed.")
+			return
+		}
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", "attachment; filename=\""+filepath.Base(name)+"\"")
+		http.ServeContent(w, r, "", st.ModTime(), file)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !follow && tail < 0 {
+		http.ServeContent(w, r, "", st.ModTime(), file)
+		return
+	}
+
+	if follow && tail < 0 {
+		tail = defaultTailLines
+	}
+	offset, e := tailOffset(file, st.Size(), tail)
+	if nil != e {
+		renderError(w, http.StatusInternalServerError, e.Error())
+		return
+	}
+	if !follow {
+		w.WriteHeader(http.StatusOK)
+		io.Copy(w, io.NewSectionReader(file, offset, st.Size()-offset))
+		return
+	}
+	self.follow(w, r, job, current, file, offset)
+}
+
+// follow sends the content of file from offset, and then sends the new
+// content until the job is stopped or the client is gone.
+func (self *webServer) follow(w http.ResponseWriter, r *http.Request, job *ShellJob, current_file func() string, file *os.File, offset int64) {
+	flusher, _ := w.(http.Flusher)
+	w.WriteHeader(http.StatusOK)
+
+	current := file
+	defer func() {
+		if current != file {
+			current.Close()
+		}
+	}()
+
+	for {
+		is_running := job.isRunning()
+
+		logfile := current_file()
+		if isRotated(current, logfile) {
+			// send the rest of the rotated file(or the file of the previous
+			// run), and then read the new file from the beginning. The old
+			// file is kept if the new file can't be opened.
+			n, _ := io.Copy(w, io.NewSectionReader(current, offset, 1<<62))
+			offset += n
+			if f, e := os.Open(logfile); nil == e {
+				if current != file {
+					current.Close()
+				}
+				current = f
+				offset = 0
+			}
+		}
+
+		var buffer bytes.Buffer
+		n, e := io.Copy(&buffer, io.NewSectionReader(current, offset, 1<<62))
+		if 0 != n {
+			offset += n
+			if _, e := w.Write(buffer.Bytes()); nil != e {
+				return
+			}
+			if nil != flusher {
+				flusher.Flush()
+			}
+		}
+		if nil != e || !is_running {
+			return
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(followInterval):
+		}
+	}
+}
+
+func isRotated(file *os.File, name string) bool {
+	st1, e := file.Stat()
+	if nil != e {
+		return false
+	}
+	st2, e := os.Stat(name)
+	if nil != e {
+		return false
+	}
+	return !os.SameFile(st1, st2)
+}
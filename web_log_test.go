@@ -0,0 +1,104 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/runner-mei/cron"
+)
+
+func logTest(t *testing.T, cb func(srv *webServer, job *ShellJob)) {
+	dir, e := ioutil.TempDir("", "sched_log")
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	job := &ShellJob{name: "abc", expression: "@every 1h", logfile: filepath.Join(dir, "job_abc.log")}
+	if e := ioutil.WriteFile(job.logfile, []byte("1\n2\n3\n4\n"), 0666); nil != e {
+		t.Error(e)
+		return
+	}
+	if e := ioutil.WriteFile(job.logfile+".0002", []byte("old\n"), 0666); nil != e {
+		t.Error(e)
+		return
+	}
+
+	cr := cron.New()
+	sch, e := Parse(job.expression)
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	cr.Schedule("abc", sch, job)
+	cb(&webServer{cr: cr, error_jobs: newErrorJobs(nil)}, job)
+}
+
+func TestReadLog(t *testing.T) {
+	logTest(t, func(srv *webServer, job *ShellJob) {
+		for _, test := range []struct {
+			url, rang string
+			code      int
+			body      string
+		}{{url: "/jobs/abc/log", code: 200, body: "1\n2\n3\n4\n"},
+			{url: "/jobs/abc/log?tail=2", code: 200, body: "3\n4\n"},
+			{url: "/jobs/abc/log?tail=0", code: 200, body: ""},
+			{url: "/jobs/abc/log?tail=10", code: 200, body: "1\n2\n3\n4\n"},
+			{url: "/jobs/abc/log", rang: "bytes=2-5", code: 206, body: "2\n3\n"},
+			{url: "/jobs/abc/log?generation=2", code: 200, body: "old\n"},
+			{url: "/jobs/abc/log?generation=1", code: 404},
+			{url: "/jobs/abc/log?generation=6", code: 400},
+			{url: "/jobs/abc/log?follow=true&generation=2", code: 400},
+			{url: "/jobs/abc/log?follow=true&tail=1", code: 200, body: "4\n"},
+			{url: "/jobs/not_exists/log", code: 404}} {
+			r := httptest.NewRequest("GET", test.url, nil)
+			if "" != test.rang {
+				r.Header.Set("Range", test.rang)
+			}
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, r)
+			if test.code != w.Code {
+				t.Error(test.url, "status code is error, ", w.Code, w.Body.String())
+				continue
+			}
+			if 300 > test.code && test.body != w.Body.String() {
+				t.Errorf("%v body is error, %q", test.url, w.Body.String())
+			}
+		}
+	})
+}
+
+func TestFollowLog(t *testing.T) {
+	logTest(t, func(srv *webServer, job *ShellJob) {
+		job.lock.Lock()
+		job.newInstance()
+		job.lock.Unlock()
+
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			file, e := os.OpenFile(job.logfile, os.O_WRONLY|os.O_APPEND, 0666)
+			if nil != e {
+				t.Error(e)
+				return
+			}
+			file.WriteString("5\n")
+			file.Close()
+			time.Sleep(2 * followInterval)
+
+			job.lock.Lock()
+			job.instances = nil
+			job.lock.Unlock()
+		}()
+
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest("GET", "/jobs/abc/log?follow=true&tail=2", nil))
+		if "3\n4\n5\n" != w.Body.String() {
+			t.Errorf("body is error, %q", w.Body.String())
+		}
+	})
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/runner-mei/cron"
+)
+
+func TestEditIsDisabled(t *testing.T) {
+	srv := &webServer{cr: cron.New(), error_jobs: newErrorJobs(nil)}
+	for _, test := range []struct {
+		method, path string
+	}{{"POST", "/jobs"}, {"PUT", "/jobs/1"}, {"DELETE", "/jobs/1"}} {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest(test.method, test.path, strings.NewReader(`{"name": "abc", "execute": "/bin/sh"}`)))
+		if http.StatusForbidden != w.Code || !strings.Contains(w.Body.String(), "web_edit") {
+			t.Error(test.method, test.path, "isn't forbidden, ", w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestLogOptionsOfDBJob(t *testing.T) {
+	job := newJobFromDB()
+	job.name = "abc"
+	job.execute = "/bin/sh"
+	applyValues(job, map[string]interface{}{"per_run_log": true, "log_max_num": 2, "output": nil})
+	if e := afterLoad(job, map[string]interface{}{"log_max_num": 7, "log_max_bytes": 1024, "output": OUTPUT_TAGGED}); nil != e {
+		t.Error(e)
+		return
+	}
+	if !job.per_run_log || 2 != job.log_max_num || 1024 != job.log_max_bytes || OUTPUT_TAGGED != job.output {
+		t.Error("log options is error, ", job.per_run_log, job.log_max_num, job.log_max_bytes, job.output)
+	}
+	if s := logOptionsString(job.log_options); `{"log_max_num":2,"per_run_log":true}` != s {
+		t.Error("log options is error, ", s)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+const JOB_WORKFLOW = "workflow"
+
+// workflow is a job of the steps, the steps run as a DAG by the dependencies
+// of them, it is defined in the job file:
+//
+//	{
+//	  "type": "workflow",
+//	  "expression": "0 0 2 * * ?",
+//	  "timeout": "2h",
+//	  "steps": [
+//	    {"name": "extract", "execute": "extract.sh", "timeout": "30m"},
+//	    {"name": "load_a", "execute": "load.sh", "arguments": ["a"], "depends_on": ["extract"]},
+//	    {"name": "load_b", "execute": "load.sh", "arguments": ["b"], "depends_on": ["extract"]},
+//	    {"name": "report", "execute": "report.sh", "depends_on": ["load_a", "load_b"]}
+//	  ]
+//	}
+//
+// the steps that the dependencies of them are succeeded run in parallel, the
+// timeout of the workflow is the overall timeout and the timeout of a step is
+// the timeout of it, the step isn't run if one of its dependencies is failed.
+// The workflow takes one place of the worker pool while it is running.
+type workflow struct {
+	steps []*workflowStep
+
+	last_results []map[string]interface{} // guarded by the lock of the job
+}
+
+type workflowStep struct {
+	name       string
+	depends_on []string
+	job        *ShellJob
+}
+
+type stepResult struct {
+	step *workflowStep
+	run  *jobRun
+}
+
+// loadWorkflow loads the steps of the workflow job, args is the same as the
+// arguments of loadJobFromMap.
+func loadWorkflow(job *ShellJob, args []map[string]interface{}) (*workflow, validationErrors) {
+	var errs validationErrors
+	flow := &workflow{}
+	values, _ := args[0]["steps"].([]interface{})
+	if 0 == len(values) {
+		errs.add("steps", "is missing.")
+	}
+	names := map[string]bool{}
+	for idx, v := range values {
+		value, ok := v.(map[string]interface{})
+		if !ok {
+			errs.add("steps", fmt.Sprintf("the step %d isn't a map - %T.", idx, v))
+			continue
+		}
+		name := stringWithDefault(value, "name", "")
+		if "" == name {
+			errs.add("steps", fmt.Sprintf("the name of the step %d is missing.", idx))
+			continue
+		}
+		if names[name] {
+			errs.add("steps", "the step '"+name+"' is duplicated.")
+			continue
+		}
+		names[name] = true
+
+		// the step runs in the directory of the workflow if it hasn't its own,
+		// the directory is only read from the step.
+		if "" == stringWithDefault(value, "directory", "") && "" != job.directory {
+			copied := map[string]interface{}{}
+			for k, v := range value {
+				copied[k] = v
+			}
+			copied["directory"] = job.directory
+			value = copied
+		}
+
+		// the expression and the timeout of the workflow are the defaults of
+		// the step, and the step inherits the other fields of the workflow.
+		step_args := append([]map[string]interface{}{value,
+			{"expression": job.expression, "timeout": job.timeout.String()}}, args...)
+		step_job, e := loadJobFromMap(job.name+"."+name, step_args)
+		if nil != e {
+			for _, fe := range toValidationErrors("file", e) {
+				errs.add("steps."+name+"."+fe.field, fe.message)
+			}
+			continue
+		}
+		step_job.name = job.name + "/" + name
+		step_job.max_retries = 0
+		step_job.depends_on = nil
+		step_job.on_success = nil
+		step_job.on_failure = nil
+		flow.steps = append(flow.steps, &workflowStep{name: name,
+			depends_on: trimStrings(stringsWithDefault(value, "depends_on", ",", nil)),
+			job:        step_job})
+	}
+
+	for _, step := range flow.steps {
+		for _, dependency := range step.depends_on {
+			if !names[dependency] {
+				errs.add("steps."+step.name+".depends_on", "'"+dependency+"' is not found.")
+			}
+		}
+	}
+	if 0 == len(errs) {
+		if path := flow.findCycle(); nil != path {
+			errs.add("steps", "dependency cycle is found, "+strings.Join(path, " -> "))
+		}
+	}
+	return flow, errs
+}
+
+func (self *workflow) step(name string) *workflowStep {
+	for _, step := range self.steps {
+		if name == step.name {
+			return step
+		}
+	}
+	return nil
+}
+
+// findCycle returns the path of a dependency cycle of the steps, or nil if
+// there isn't any cycle.
+func (self *workflow) findCycle() []string {
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := map[string]int{}
+	var path []string
+	var visit func(step *workflowStep) []string
+	visit = func(step *workflowStep) []string {
+		states[step.name] = visiting
+		path = append(path, step.name)
+		for _, dependency := range step.depends_on {
+			switch states[dependency] {
+			case visiting:
+				for idx, name := range path {
+					if name == dependency {
+						return append(append([]string(nil), path[idx:]...), dependency)
+					}
+				}
+			case unvisited:
+				if cycle := visit(self.step(dependency)); nil != cycle {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		states[step.name] = visited
+		return nil
+	}
+	for _, step := range self.steps {
+		if unvisited == states[step.name] {
+			if cycle := visit(step); nil != cycle {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
+
+func (self *workflow) isReady(step *workflowStep, results map[string]*jobRun) bool {
+	for _, dependency := range step.depends_on {
+		if run, ok := results[dependency]; !ok || RUN_OK != run.status {
+			return false
+		}
+	}
+	return true
+}
+
+// run runs the steps of the workflow, the result of the run is the aggregate
+// of the results of the steps.
+func (self *workflow) run(job *ShellJob, instance *runInstance, attempt int) *jobRun {
+	run := &jobRun{job_id: job.id,
+		job_name:  job.name,
+		attempt:   attempt,
+		begin_at:  time.Now(),
+		status:    RUN_FAILED,
+		RunResult: RunResult{ExitCode: -1}}
+	defer func() {
+		run.end_at = time.Now()
+	}()
+
+	logfile, e := job.openLogFile(run.begin_at)
+	if nil != e {
+		log.Println("["+job.name+"] open log file("+logfile+") failed,", e)
+		run.log_excerpt = "open log file(" + logfile + ") failed, " + e.Error()
+		return run
+	}
+	run.log_file = logfile
+	out, e := os.OpenFile(logfile, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
+	if nil != e {
+		log.Println("["+job.name+"] open log file("+logfile+") failed,", e)
+		run.log_excerpt = "open log file(" + logfile + ") failed, " + e.Error()
+		return run
+	}
+	defer out.Close()
+	offset, _ := out.Seek(0, os.SEEK_END)
+	defer func() {
+		run.log_excerpt = readExcerpt(logfile, offset, maxExcerptBytes)
+	}()
+	io.WriteString(out, "=============== begin workflow at "+run.begin_at.Format(outputTimeLayout)+" ===============\r\n")
+	defer func() {
+		now := time.Now()
+		io.WriteString(out, "===============  end workflow at "+now.Format(outputTimeLayout)+", duration "+now.Sub(run.begin_at).String()+" ===============\r\n")
+	}()
+
+	results := map[string]*jobRun{}
+	instances := map[string]*runInstance{}
+	done := make(chan stepResult, len(self.steps))
+	start := func(step *workflowStep) {
+		step_instance := newRunInstance()
+		instances[step.name] = step_instance
+		io.WriteString(out, time.Now().Format(outputTimeLayout)+" start step '"+step.name+"'.\r\n")
+		go func() {
+			if e := step.job.rotate_file(); nil != e {
+				log.Println("["+step.job.name+"] rotate log file failed,", e)
+			}
+			done <- stepResult{step: step, run: step.job.do_run(step_instance, 0)}
+		}()
+	}
+	schedule := func() {
+		for _, step := range self.steps {
+			if _, ok := instances[step.name]; !ok && self.isReady(step, results) {
+				start(step)
+			}
+		}
+	}
+	killAll := func(status string) {
+		for name, step_instance := range instances {
+			if _, ok := results[name]; !ok {
+				go func(name string, step_instance *runInstance) {
+					if e := step_instance.kill(status); nil != e {
+						log.Println("["+job.name+"] kill the step '"+name+"' failed,", e)
+					}
+				}(name, step_instance)
+			}
+		}
+	}
+
+	is_failed := false
+	is_timeout := false
+	killed := instance.killed
+	timeout := time.After(job.timeout)
+	schedule()
+	for len(results) < len(instances) {
+		select {
+		case result := <-done:
+			results[result.step.name] = result.run
+			io.WriteString(out, time.Now().Format(outputTimeLayout)+" step '"+result.step.name+"' is "+result.run.status+
+				", exit code "+fmt.Sprint(result.run.ExitCode)+", duration "+result.run.end_at.Sub(result.run.begin_at).String()+".\r\n")
+			if nil != job.backend {
+				result.run.job_id = job.id
+				if e := job.backend.saveRun(result.run); nil != e {
+					log.Println("["+result.step.job.name+"] save run history failed,", e)
+				}
+			}
+			if RUN_OK != result.run.status {
+				is_failed = true
+			} else if !is_failed && !is_timeout && !instance.isKilled() {
+				schedule()
+			}
+		case <-timeout:
+			timeout = nil
+			is_timeout = true
+			io.WriteString(out, "workflow timeout, kill the running steps.\r\n")
+			log.Println("[" + job.name + "] run timeout, kill the running steps.")
+			killAll(RUN_TIMEOUT)
+		case <-killed:
+			killed = nil
+			killAll(instance.killedStatus())
+		}
+	}
+
+	step_results := make([]map[string]interface{}, 0, len(self.steps))
+	run.ExitCode = 0
+	for _, step := range self.steps {
+		result, ok := results[step.name]
+		if !ok {
+			io.WriteString(out, "step '"+step.name+"' is skipped.\r\n")
+			step_results = append(step_results, map[string]interface{}{"name": step.name, "status": RUN_SKIPPED})
+			continue
+		}
+		info := result.RunResult.toMap()
+		info["name"] = step.name
+		info["status"] = result.status
+		info["begin_at"] = result.begin_at
+		info["end_at"] = result.end_at
+		info["log_file"] = result.log_file
+		step_results = append(step_results, info)
+		if RUN_OK != result.status && 0 == run.ExitCode {
+			run.ExitCode = result.ExitCode
+			run.Signal = result.Signal
+			run.stderr_tail = result.stderr_tail
+		}
+	}
+	job.lock.Lock()
+	self.last_results = step_results
+	job.lock.Unlock()
+
+	run.Duration = time.Now().Sub(run.begin_at)
+	if status := instance.killedStatus(); "" != status {
+		run.status = status
+	} else if is_timeout {
+		run.status = RUN_TIMEOUT
+		run.IsTimeout = true
+	} else if !is_failed && len(results) == len(self.steps) {
+		run.status = RUN_OK
+	} else if 0 == run.ExitCode {
+		run.ExitCode = -1
+	}
+	io.WriteString(out, "workflow "+run.status+".\r\n")
+	return run
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadWorkflowTest(t *testing.T, dir, text string) (*ShellJob, error) {
+	var value map[string]interface{}
+	if e := json.Unmarshal([]byte(text), &value); nil != e {
+		t.Fatal(e)
+	}
+	old := *log_path
+	*log_path = dir
+	defer func() {
+		*log_path = old
+	}()
+	return loadJobFromMap("wf.json", []map[string]interface{}{value, {"root_dir": dir}})
+}
+
+func TestLoadWorkflow(t *testing.T) {
+	for _, test := range []struct {
+		text  string
+		error string
+	}{{text: `{"type": "workflow", "expression": "@every 1h"}`, error: "'steps' is missing."},
+		{text: `{"type": "workflow", "expression": "@every 1h", "steps": [{"name": "a", "execute": "/bin/sh"}, {"name": "a", "execute": "/bin/sh"}]}`,
+			error: "the step 'a' is duplicated."},
+		{text: `{"type": "workflow", "expression": "@every 1h", "steps": [{"name": "a"}]}`,
+			error: "'steps.a.execute' is missing."},
+		{text: `{"type": "workflow", "expression": "@every 1h", "steps": [{"name": "a", "execute": "/bin/sh", "depends_on": ["b"]}]}`,
+			error: "'steps.a.depends_on' 'b' is not found."},
+		{text: `{"type": "workflow", "expression": "@every 1h", "steps": [{"name": "a", "execute": "/bin/sh", "depends_on": ["c"]},
+			{"name": "b", "execute": "/bin/sh", "depends_on": ["a"]}, {"name": "c", "execute": "/bin/sh", "depends_on": ["b"]}]}`,
+			error: "dependency cycle is found, a -> c -> b -> a"}} {
+		_, e := loadWorkflowTest(t, ".", test.text)
+		if nil == e || !strings.Contains(e.Error(), test.error) {
+			t.Error("excepted error is", test.error, ", actual is", e)
+		}
+	}
+
+	job, e := loadWorkflowTest(t, "logs", `{"type": "workflow", "expression": "@every 1h", "timeout": "1h",
+		"steps": [{"name": "a", "execute": "/bin/sh", "timeout": "1m"}, {"name": "b", "execute": "/bin/sh", "depends_on": "a"}]}`)
+	if nil != e {
+		t.Error(e)
+		return
+	}
+	if 2 != len(job.workflow.steps) || "wf.json/b" != job.workflow.steps[1].job.name ||
+		time.Minute != job.workflow.steps[0].job.timeout || time.Hour != job.workflow.steps[1].job.timeout ||
+		"a" != job.workflow.steps[1].depends_on[0] || "logs/job_wf.json.b.log" != job.workflow.steps[1].job.logfile {
+		t.Error("workflow is error, ", job.workflow.steps[0].job, job.workflow.steps[1].job)
+	}
+}
+
+func TestRunWorkflow(t *testing.T) {
+	shellJobTest(t, func(dir string, _ *ShellJob) {
+		job, e := loadWorkflowTest(t, dir, `{"type": "workflow", "expression": "@every 1h", "timeout": "10s", "steps": [
+			{"name": "a", "execute": "/bin/sh", "arguments": ["-c", "echo a"]},
+			{"name": "b", "execute": "/bin/sh", "arguments": ["-c", "sleep 0.3"], "depends_on": ["a"]},
+			{"name": "c", "execute": "/bin/sh", "arguments": ["-c", "sleep 0.3"], "depends_on": ["a"]},
+			{"name": "d", "execute": "/bin/sh", "arguments": ["-c", "echo d"], "depends_on": ["b", "c"]}]}`)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		job.logfile = dir + "/job_wf.json.log"
+
+		started_at := time.Now()
+		run := job.workflow.run(job, newRunInstance(), 0)
+		if RUN_OK != run.status || 0 != run.ExitCode {
+			t.Error("status is error, ", run.status, run.log_excerpt)
+		}
+		if elapsed := time.Now().Sub(started_at); elapsed > 550*time.Millisecond {
+			t.Error("the steps don't run in parallel, ", elapsed)
+		}
+		if steps := job.Stats()["last_steps"].([]map[string]interface{}); 4 != len(steps) || RUN_OK != steps[3]["status"] {
+			t.Error("steps is error, ", steps)
+		}
+
+		job.workflow.steps[1].job.arguments = []string{"-c", "echo failed 1>&2; exit 3"}
+		run = job.workflow.run(job, newRunInstance(), 0)
+		if RUN_FAILED != run.status || 3 != run.ExitCode || "failed\n" != run.stderr_tail {
+			t.Errorf("status is error, %v %v %q", run.status, run.ExitCode, run.stderr_tail)
+		}
+		if !strings.Contains(run.log_excerpt, "step 'd' is skipped.") {
+			t.Error("step d isn't skipped, ", run.log_excerpt)
+		}
+
+		job.timeout = 200 * time.Millisecond
+		job.workflow.steps[1].job.arguments = []string{"-c", "sleep 5"}
+		started_at = time.Now()
+		run = job.workflow.run(job, newRunInstance(), 0)
+		if RUN_TIMEOUT != run.status || !run.IsTimeout {
+			t.Error("status is error, ", run.status, run.log_excerpt)
+		}
+		if elapsed := time.Now().Sub(started_at); elapsed > 2*time.Second {
+			t.Error("the workflow isn't killed while it is timeout, ", elapsed)
+		}
+	})
+}
+
+func TestDirectoryOfWorkflow(t *testing.T) {
+	shellJobTest(t, func(dir string, _ *ShellJob) {
+		work_dir := filepath.Join(dir, "work")
+		if e := os.Mkdir(work_dir, 0755); nil != e {
+			t.Error(e)
+			return
+		}
+		if e := ioutil.WriteFile(filepath.Join(work_dir, "step.sh"), []byte("#!/bin/sh\npwd\n"), 0755); nil != e {
+			t.Error(e)
+			return
+		}
+
+		job, e := loadWorkflowTest(t, dir, `{"type": "workflow", "expression": "@every 1h", "timeout": "10s",
+			"directory": "`+work_dir+`", "steps": [
+			{"name": "a", "execute": "./step.sh"},
+			{"name": "b", "execute": "/bin/sh", "arguments": ["-c", "pwd"], "directory": "`+dir+`"}]}`)
+		if nil != e {
+			t.Error(e)
+			return
+		}
+		if work_dir != job.workflow.steps[0].job.directory || dir != job.workflow.steps[1].job.directory {
+			t.Error("the directory of the steps is error, ", job.workflow.steps[0].job.directory, job.workflow.steps[1].job.directory)
+		}
+		if errs := validateJob(job); 0 != len(errs) {
+			t.Error(errs)
+		}
+		job.logfile = filepath.Join(dir, "job_wf.json.log")
+
+		run := job.workflow.run(job, newRunInstance(), 0)
+		if RUN_OK != run.status {
+			t.Error("status is error, ", run.status, run.log_excerpt)
+		}
+		bs, _ := ioutil.ReadFile(job.workflow.steps[0].job.logfile)
+		if !strings.Contains(string(bs), "work\n") {
+			t.Error("the step doesn't run in the directory of the workflow, ", string(bs))
+		}
+	})
+}